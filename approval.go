@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+	//freeze windows can name a timezone, the container image has no zoneinfo
+	_ "time/tzdata"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// FreezeWindow is a recurring period in which records are not updated, e.g. during maintenance
+type FreezeWindow struct {
+	//Days the window starts on, e.g. Sat, every day if empty
+	Days []string `json:"days,omitempty"`
+	//Start and End in HH:MM, a window with End before Start lasts past midnight
+	Start string `json:"start"`
+	End   string `json:"end"`
+	//Timezone of Start and End, e.g. Europe/Berlin, local time if empty
+	Timezone string `json:"timezone,omitempty"`
+
+	days       map[time.Weekday]bool
+	start, end time.Duration
+	location   *time.Location
+}
+
+func (fw *FreezeWindow) validate() error {
+	fw.days = make(map[time.Weekday]bool)
+	for _, day := range fw.Days {
+		name := strings.ToLower(day)
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		wd, ok := weekdays[name]
+		if !ok {
+			return fmt.Errorf("invalid day %s in freeze window", day)
+		}
+		fw.days[wd] = true
+	}
+	var err error
+	if fw.start, err = parseClock(fw.Start); err != nil {
+		return err
+	}
+	if fw.end, err = parseClock(fw.End); err != nil {
+		return err
+	}
+	fw.location = time.Local
+	if fw.Timezone != "" {
+		if fw.location, err = time.LoadLocation(fw.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone in freeze window: %v", err)
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into the time since midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q in freeze window, must be HH:MM", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// active reports whether t is inside the window
+func (fw *FreezeWindow) active(t time.Time) bool {
+	t = t.In(fw.location)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	startsOn := func(day time.Weekday) bool {
+		return len(fw.days) == 0 || fw.days[day]
+	}
+	if fw.start < fw.end {
+		return startsOn(t.Weekday()) && sinceMidnight >= fw.start && sinceMidnight < fw.end
+	}
+	//the window lasts past midnight, so early in the morning it belongs to the previous day
+	if sinceMidnight >= fw.start {
+		return startsOn(t.Weekday())
+	}
+	return sinceMidnight < fw.end && startsOn((t.Weekday()+6)%7)
+}
+
+// frozen reports whether the record is inside one of its freeze windows, records without own windows use the
+// freezeWindows of the configuration file
+func frozen(rc *RecordConfig, t time.Time) bool {
+	windows := fileConfig.FreezeWindows
+	if rc.FreezeWindows != nil {
+		windows = rc.FreezeWindows
+	}
+	for _, fw := range windows {
+		if fw.active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingChange is a record update waiting for approval
+type PendingChange struct {
+	ID       string    `json:"id"`
+	FQDN     string    `json:"fqdn"`
+	OldValue string    `json:"oldValue"`
+	NewValue string    `json:"newValue"`
+	Created  time.Time `json:"created"`
+	Approved bool      `json:"approved"`
+	//Reason is why the change needs approval if the record doesn't always need it, e.g. a jump to another network
+	Reason string `json:"reason,omitempty"`
+	//Key authorizes approving or rejecting this change through the callback URL sent in the notification
+	Key string `json:"key"`
+}
+
+// awaitApproval reports whether the update of the record to value was approved. Otherwise it queues the change for
+// approval and notifies about it, replacing any queued change with another value.
+// Approved changes stay queued until the caller wrote them and calls approvalWritten, so a failed write doesn't need
+// another approval.
+func awaitApproval(ctx context.Context, domain, fqdn, oldValue, value, reason string) bool {
+	stateMu.Lock()
+	var queued *PendingChange
+	for id, pc := range state.Pending {
+		if pc.FQDN != fqdn {
+			continue
+		}
+		if pc.NewValue == value {
+			queued = pc
+			continue
+		}
+		log.Infof("Dropping pending change %s of %s to %s, the value changed again", id, fqdn, pc.NewValue)
+		delete(state.Pending, id)
+	}
+	if queued != nil && queued.Approved {
+		stateMu.Unlock()
+		log.Infof("Change %s of %s to %s was approved", queued.ID, fqdn, value)
+		return true
+	}
+	if queued != nil {
+		stateMu.Unlock()
+		log.Infof("Change %s of %s to %s is waiting for approval", queued.ID, fqdn, value)
+		return false
+	}
+	pc := &PendingChange{
+		ID:       randomHex(4),
+		FQDN:     fqdn,
+		OldValue: oldValue,
+		NewValue: value,
+		Created:  time.Now(),
+		Reason:   reason,
+		Key:      randomHex(16),
+	}
+	state.Pending[pc.ID] = pc
+	stateMu.Unlock()
+
+	msg := fmt.Sprintf("change %s of %s from %s to %s needs approval", pc.ID, fqdn, describeValue(oldValue), value)
+	if reason != "" {
+		msg += fmt.Sprintf(" (%s)", reason)
+	}
+	msg += fmt.Sprintf(", run `go-ddns approvals approve %s`", pc.ID)
+	if controlURL != "" {
+		msg += fmt.Sprintf(" or POST %s/approvals/%s/approve?key=%s", strings.TrimSuffix(controlURL, "/"), pc.ID, pc.Key)
+	}
+	log.Infof("Queued %s", msg)
+	notify(ctx, "approval-required", domain, msg)
+	return false
+}
+
+// approvalWritten removes the approved changes of the record from the queue once they were written
+func approvalWritten(fqdn string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for id, pc := range state.Pending {
+		if pc.FQDN == fqdn && pc.Approved {
+			delete(state.Pending, id)
+		}
+	}
+}
+
+// decide approves or rejects the pending change id. If key is not empty it has to match the key of the change.
+func decide(id, key string, approve bool) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	pc, ok := state.Pending[id]
+	if !ok || (key != "" && key != pc.Key) {
+		return fmt.Errorf("no pending change %s", id)
+	}
+	if approve {
+		pc.Approved = true
+	} else {
+		delete(state.Pending, id)
+	}
+	return nil
+}
+
+// pendingChanges returns a copy of all queued changes without their keys
+func pendingChanges() []PendingChange {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	res := make([]PendingChange, 0, len(state.Pending))
+	for _, pc := range state.Pending {
+		c := *pc
+		c.Key = ""
+		res = append(res, c)
+	}
+	return res
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestApprovalSurvivesFailedWrite(t *testing.T) {
+	defer func(s *State) { state = s }(state)
+	state = newState()
+	ctx := context.Background()
+
+	if awaitApproval(ctx, "example.com", "www.example.com", "192.0.2.1", "192.0.2.2", "") {
+		t.Fatal("awaitApproval() approved a new change")
+	}
+	changes := pendingChanges()
+	if len(changes) != 1 {
+		t.Fatalf("pendingChanges() = %v, want one queued change", changes)
+	}
+	id := changes[0].ID
+	if err := decide(id, "", true); err != nil {
+		t.Fatal(err)
+	}
+
+	//the write after the approval fails, the next run must not ask again
+	for run := 0; run < 2; run++ {
+		if !awaitApproval(ctx, "example.com", "www.example.com", "192.0.2.1", "192.0.2.2", "") {
+			t.Fatalf("run %d: awaitApproval() did not return the approval", run)
+		}
+		if _, ok := state.Pending[id]; !ok {
+			t.Fatalf("run %d: approved change was dropped before it was written", run)
+		}
+	}
+
+	approvalWritten("www.example.com")
+	if len(state.Pending) != 0 {
+		t.Errorf("approved change is still queued after it was written: %v", state.Pending)
+	}
+}
+
+func TestApprovalDroppedForNewValue(t *testing.T) {
+	defer func(s *State) { state = s }(state)
+	state = newState()
+	ctx := context.Background()
+
+	awaitApproval(ctx, "example.com", "www.example.com", "192.0.2.1", "192.0.2.2", "")
+	id := pendingChanges()[0].ID
+	if err := decide(id, "", true); err != nil {
+		t.Fatal(err)
+	}
+	//the IP changed again before the approved value was written
+	if awaitApproval(ctx, "example.com", "www.example.com", "192.0.2.1", "192.0.2.3", "") {
+		t.Error("awaitApproval() applied the approval to another value")
+	}
+	if _, ok := state.Pending[id]; ok {
+		t.Error("approval for the old value is still queued")
+	}
+}
+
+func TestFreezeWindowActive(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overnight := &FreezeWindow{Days: []string{"Sat"}, Start: "22:00", End: "06:00", Timezone: "Europe/Berlin"}
+	daily := &FreezeWindow{Start: "09:00", End: "17:00", Timezone: "Europe/Berlin"}
+	everyNight := &FreezeWindow{Start: "23:30", End: "00:30", Timezone: "Europe/Berlin"}
+	for _, fw := range []*FreezeWindow{overnight, daily, everyNight} {
+		if err := fw.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//2026-10-17 is a Saturday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, berlin)
+	}
+	tests := []struct {
+		name   string
+		window *FreezeWindow
+		t      time.Time
+		want   bool
+	}{
+		{"before start", overnight, at(17, 21, 59), false},
+		{"at start", overnight, at(17, 22, 0), true},
+		{"past midnight", overnight, at(18, 3, 0), true},
+		{"just before end", overnight, at(18, 5, 59), true},
+		{"at end", overnight, at(18, 6, 0), false},
+		{"early on the start day", overnight, at(17, 3, 0), false},
+		{"night before the start day", overnight, at(16, 23, 0), false},
+		{"next evening", overnight, at(18, 22, 30), false},
+		{"in another timezone", overnight, time.Date(2026, 10, 17, 20, 30, 0, 0, time.UTC), true},
+		{"outside in another timezone", overnight, time.Date(2026, 10, 17, 19, 59, 0, 0, time.UTC), false},
+		{"daily", daily, at(14, 12, 0), true},
+		{"daily after end", daily, at(14, 17, 0), false},
+		{"every night before midnight", everyNight, at(14, 23, 45), true},
+		{"every night after midnight", everyNight, at(15, 0, 15), true},
+		{"every night afterwards", everyNight, at(15, 0, 30), false},
+	}
+	for _, tt := range tests {
+		if got := tt.window.active(tt.t); got != tt.want {
+			t.Errorf("%s: active(%v) = %v, want %v", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// modes of GD_ASN_GUARD
+const (
+	asnGuardOff   = "off"
+	asnGuardWarn  = "warn"
+	asnGuardBlock = "block"
+)
+
+// asnRange is a range of addresses announced by one autonomous system, as listed in the iptoasn.com database
+type asnRange struct {
+	start, end  netip.Addr
+	asn         uint32
+	country     string
+	description string
+}
+
+func (r *asnRange) String() string {
+	return fmt.Sprintf("AS%d (%s, %s)", r.asn, r.description, r.country)
+}
+
+// asnDB is sorted by the start of the ranges
+var asnDB []asnRange
+
+// loadASNDB reads an ip2asn TSV file from iptoasn.com, gzipped if the name ends in .gz
+func loadASNDB(path string) error {
+	asnDB = nil
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 5 {
+			continue
+		}
+		start, err1 := netip.ParseAddr(fields[0])
+		end, err2 := netip.ParseAddr(fields[1])
+		asn, err3 := strconv.ParseUint(fields[2], 10, 32)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return fmt.Errorf("invalid entry in line %d of %s", line, path)
+		}
+		//AS 0 marks ranges that are not routed
+		if asn == 0 {
+			continue
+		}
+		asnDB = append(asnDB, asnRange{start: start, end: end, asn: uint32(asn), country: fields[3], description: fields[4]})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	sort.Slice(asnDB, func(i, j int) bool { return asnDB[i].start.Less(asnDB[j].start) })
+	return nil
+}
+
+// lookupASN returns the range addr is in, nil if it is not routed or not in the database
+func lookupASN(addr netip.Addr) *asnRange {
+	i := sort.Search(len(asnDB), func(i int) bool { return addr.Less(asnDB[i].start) }) - 1
+	if i < 0 || asnDB[i].end.Less(addr) {
+		return nil
+	}
+	return &asnDB[i]
+}
+
+// asnJump describes why publishing value instead of the previous value is suspicious, e.g. because an IP source
+// returned the address of a proxy. It returns an empty string if value is in the same network and country.
+func asnJump(rc *RecordConfig, previous, value string) string {
+	if asnGuard == asnGuardOff || previous == "" || previous == value {
+		return ""
+	}
+	//only the public IP can jump to a stranger's network, addresses of interfaces and overlays are private anyway
+	if kind, _, _ := parseSource(rc.Source); kind != sourcePublic {
+		return ""
+	}
+	oldAddr, err1 := netip.ParseAddr(previous)
+	newAddr, err2 := netip.ParseAddr(value)
+	if err1 != nil || err2 != nil {
+		return ""
+	}
+	old, cur := lookupASN(oldAddr), lookupASN(newAddr)
+	switch {
+	case old == nil:
+		return ""
+	case cur == nil:
+		return fmt.Sprintf("%s is not in any known network, %s was in %s", value, previous, old)
+	case asnAllowed[cur.asn]:
+		return ""
+	case cur.asn != old.asn || cur.country != old.country:
+		return fmt.Sprintf("%s is in %s, %s was in %s", value, cur, previous, old)
+	}
+	return ""
+}
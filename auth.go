@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runAuth manages the encrypted credential store with the subcommands add, list and remove.
+// It returns the exit code for the auth command.
+func runAuth(args []string) int {
+	path := os.Getenv("GD_CREDENTIALS_FILE")
+	if path == "" {
+		path = defaultCredentialsFile()
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: auth add <name> | auth list | auth remove <name>")
+		return 2
+	}
+	creds, err := loadCredentials(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open credential store %s: %v\n", path, err)
+		return 1
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		names := make([]string, 0, len(creds))
+		for name := range creds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%s\t%s\n", name, creds[name].Provider, maskKey(creds[name].Key))
+		}
+		return 0
+	case args[0] == "add" && len(args) == 2:
+		in := bufio.NewReader(os.Stdin)
+		key := prompt(in, "GoDaddy API Key: ")
+		secret := promptSecret(in, "GoDaddy API Secret: ")
+		if key == "" || secret == "" {
+			fmt.Fprintln(os.Stderr, "API Key and Secret must not be empty")
+			return 1
+		}
+		creds[args[1]] = Credential{Provider: "godaddy", Key: key, Secret: secret}
+	case args[0] == "remove" && len(args) == 2:
+		if _, ok := creds[args[1]]; !ok {
+			fmt.Fprintf(os.Stderr, "No credential named %s\n", args[1])
+			return 1
+		}
+		delete(creds, args[1])
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: auth add <name> | auth list | auth remove <name>")
+		return 2
+	}
+
+	if err := saveCredentials(path, creds); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save credential store %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Printf("Saved credential store %s\n", path)
+	return 0
+}
+
+// prompt asks for a single line on stdin, so values can also be piped in
+func prompt(in *bufio.Reader, question string) string {
+	fmt.Print(question)
+	line, _ := in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// maskKey only shows the first characters of an API key
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return key[:4] + strings.Repeat("*", len(key)-4)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultIPSources = []string{"http://ifconfig.co"}
+
+// defaultShutdownGrace stays below the 10 seconds docker waits before killing a stopped container
+const defaultShutdownGrace = 8 * time.Second
+
+// loadConfig reads the configuration from the environment
+func loadConfig() error {
+	interval := os.Getenv("GD_INTERVAL")
+	var err error
+	updateInterval, err = time.ParseDuration(interval)
+	if err != nil {
+		log.Warn("No update interval given, defaulting to 600 seconds.")
+		updateInterval = defaultInterval
+	}
+
+	if err := loadAPICredentials(); err != nil {
+		return err
+	}
+	domains = splitList(os.Getenv("GD_DOMAINS"))
+	if len(domains) < 1 {
+		return errors.New("no domains provided in environment (GD_DOMAINS)")
+	}
+	recordNames = []string{"@"}
+	if names := splitList(os.Getenv("GD_RECORDS")); len(names) > 0 {
+		recordNames = names
+	}
+	hostsFile = os.Getenv("GD_HOSTS_FILE")
+	if err := loadConfigFile(os.Getenv("GD_CONFIG")); err != nil {
+		return fmt.Errorf("invalid configuration file in GD_CONFIG: %v", err)
+	}
+	warnUnknownRecords()
+	ipSources = defaultIPSources
+	if sources := splitList(os.Getenv("GD_IP_SOURCES")); len(sources) > 0 {
+		ipSources = sources
+	}
+	notifyURL = os.Getenv("GD_NOTIFY_URL")
+	stateFile = os.Getenv("GD_STATE_FILE")
+	summaryFile = os.Getenv("GD_SUMMARY_FILE")
+	driftPolicy = driftPolicyOverwrite
+	if policy := os.Getenv("GD_DRIFT_POLICY"); policy != "" {
+		switch policy {
+		case driftPolicyOverwrite, driftPolicyAlert, driftPolicyAdopt:
+			driftPolicy = policy
+		default:
+			return fmt.Errorf("invalid drift policy %q in GD_DRIFT_POLICY, must be one of overwrite, alert or adopt", policy)
+		}
+	}
+	ownershipMode = ownershipOff
+	if mode := os.Getenv("GD_OWNERSHIP"); mode != "" {
+		switch mode {
+		case ownershipOff, ownershipTXT, ownershipState:
+			ownershipMode = mode
+		default:
+			return fmt.Errorf("invalid ownership mode %q in GD_OWNERSHIP, must be one of off, txt or state", mode)
+		}
+	}
+	ownerID = os.Getenv("GD_OWNER_ID")
+	if ownerID == "" {
+		ownerID = "default"
+	}
+	allowTakeover, err = parseBool("GD_ALLOW_TAKEOVER")
+	if err != nil {
+		return err
+	}
+	verify, err = parseBool("GD_VERIFY")
+	if err != nil {
+		return err
+	}
+	lookupResolver = nil
+	if spec := os.Getenv("GD_DNS_RESOLVER"); spec != "" {
+		if lookupResolver, err = parseResolver(spec); err != nil {
+			return fmt.Errorf("invalid GD_DNS_RESOLVER: %v", err)
+		}
+		net.DefaultResolver = lookupResolver.netResolver()
+	}
+	verifyResolver = lookupResolver
+	if spec := os.Getenv("GD_VERIFY_RESOLVER"); spec != "" {
+		if verifyResolver, err = parseResolver(spec); err != nil {
+			return fmt.Errorf("invalid GD_VERIFY_RESOLVER: %v", err)
+		}
+	}
+	if verify && (verifyResolver == nil || !verifyResolver.trusted()) {
+		return errors.New("GD_VERIFY needs a validating DNS-over-TLS or DNS-over-HTTPS resolver (or one on this host) " +
+			"in GD_VERIFY_RESOLVER or GD_DNS_RESOLVER")
+	}
+	asnGuard = asnGuardOff
+	asnAllowed = make(map[uint32]bool)
+	if db := os.Getenv("GD_ASN_DB"); db != "" {
+		if err := loadASNDB(db); err != nil {
+			return fmt.Errorf("failed to load ASN database from GD_ASN_DB: %v", err)
+		}
+		asnGuard = asnGuardBlock
+		for _, asn := range splitList(os.Getenv("GD_ASN_ALLOW")) {
+			n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(asn), "AS"), 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid AS number %q in GD_ASN_ALLOW", asn)
+			}
+			asnAllowed[uint32(n)] = true
+		}
+	}
+	if mode := os.Getenv("GD_ASN_GUARD"); mode != "" {
+		switch mode {
+		case asnGuardOff, asnGuardWarn, asnGuardBlock:
+			asnGuard = mode
+		default:
+			return fmt.Errorf("invalid ASN guard mode %q in GD_ASN_GUARD, must be one of off, warn or block", mode)
+		}
+		if asnGuard != asnGuardOff && len(asnDB) == 0 {
+			return errors.New("GD_ASN_GUARD needs an ASN database in GD_ASN_DB")
+		}
+	}
+	natCheck = natCheckOff
+	if mode := os.Getenv("GD_NAT_CHECK"); mode != "" {
+		switch mode {
+		case natCheckOff, natCheckWarn, natCheckBlock:
+			natCheck = mode
+		default:
+			return fmt.Errorf("invalid NAT check mode %q in GD_NAT_CHECK, must be one of off, warn or block", mode)
+		}
+	}
+	natGateway = os.Getenv("GD_NAT_GATEWAY")
+	reachabilityPort = os.Getenv("GD_REACHABILITY_PORT")
+	reachabilityHelper = os.Getenv("GD_REACHABILITY_HELPER")
+	if reachabilityHelper != "" && !strings.Contains(reachabilityHelper, "{url}") {
+		return errors.New("GD_REACHABILITY_HELPER must contain {url}")
+	}
+	controlAddr = os.Getenv("GD_CONTROL_ADDR")
+	controlToken = os.Getenv("GD_CONTROL_TOKEN")
+	controlURL = os.Getenv("GD_CONTROL_URL")
+	if controlAddr != "" && controlToken == "" {
+		return errors.New("GD_CONTROL_ADDR needs GD_CONTROL_TOKEN to be set")
+	}
+	//queued changes can only be decided through the control API, without it they would wait forever
+	if controlAddr == "" {
+		if asnGuard == asnGuardBlock {
+			return errors.New("GD_ASN_GUARD=block queues changes for approval and needs GD_CONTROL_ADDR, set it or use GD_ASN_GUARD=warn")
+		}
+		for fqdn, rc := range fileConfig.Records {
+			if rc.Approval {
+				return fmt.Errorf("%s needs approval for every change, which needs GD_CONTROL_ADDR to be set", fqdn)
+			}
+		}
+	}
+	ttlMin, err = parseTTL("GD_TTL_MIN")
+	if err != nil {
+		return err
+	}
+	ttlMax, err = parseTTL("GD_TTL_MAX")
+	if err != nil {
+		return err
+	}
+	if ttlMin > ttlMax {
+		return fmt.Errorf("GD_TTL_MIN (%d) must not be greater than GD_TTL_MAX (%d)", ttlMin, ttlMax)
+	}
+	ttlStableAfter = time.Hour
+	if stable := os.Getenv("GD_TTL_STABLE_AFTER"); stable != "" {
+		ttlStableAfter, err = time.ParseDuration(stable)
+		if err != nil {
+			return fmt.Errorf("invalid stable period in GD_TTL_STABLE_AFTER: %v", err)
+		}
+	}
+	forceInterval = 0
+	if interval := os.Getenv("GD_FORCE_INTERVAL"); interval != "" {
+		forceInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("invalid force interval in GD_FORCE_INTERVAL: %v", err)
+		}
+	}
+	shutdownGrace = defaultShutdownGrace
+	if grace := os.Getenv("GD_SHUTDOWN_GRACE"); grace != "" {
+		shutdownGrace, err = time.ParseDuration(grace)
+		if err != nil {
+			return fmt.Errorf("invalid shutdown grace period in GD_SHUTDOWN_GRACE: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadAPICredentials takes the godaddy credentials from GD_API_KEY and GD_API_SECRET, or from the credential store
+// entry named in GD_CREDENTIAL if GD_API_KEY is not set
+func loadAPICredentials() error {
+	apiKey = os.Getenv("GD_API_KEY")
+	apiSecret = os.Getenv("GD_API_SECRET")
+	credentialName = os.Getenv("GD_CREDENTIAL")
+	if apiKey != "" {
+		if apiSecret == "" {
+			return errors.New("no API Secret provided in environment (GD_API_SECRET)")
+		}
+		credentialName = "env"
+		return nil
+	}
+	if credentialName == "" {
+		return errors.New("no API Key provided in environment (GD_API_KEY) and no stored credential selected (GD_CREDENTIAL)")
+	}
+	path := os.Getenv("GD_CREDENTIALS_FILE")
+	if path == "" {
+		path = defaultCredentialsFile()
+	}
+	creds, err := loadCredentials(path)
+	if err != nil {
+		return fmt.Errorf("failed to open credential store %s: %v", path, err)
+	}
+	cred, ok := creds[credentialName]
+	if !ok {
+		return fmt.Errorf("no credential named %s in credential store %s", credentialName, path)
+	}
+	apiKey, apiSecret = cred.Key, cred.Secret
+	return nil
+}
+
+// warnUnknownRecords warns about settings in the configuration file for records that are not updated at all
+func warnUnknownRecords() {
+	known := make(map[string]bool)
+	for _, domain := range domains {
+		for _, name := range recordNames {
+			known[recordFQDN(name, domain)] = true
+		}
+	}
+	for fqdn := range fileConfig.Records {
+		if !known[fqdn] {
+			log.Warnf("Configuration file has settings for %s, but it is not one of the updated records", fqdn)
+		}
+	}
+}
+
+// parseTTL parses the TTL in seconds in the environment variable name, an unset variable is defaultTTL
+func parseTTL(name string) (uint64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultTTL, nil
+	}
+	ttl, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid TTL %q in %s, must be a number of seconds", value, name)
+	}
+	if ttl < minTTL {
+		return 0, fmt.Errorf("TTL %d in %s is too low, godaddy does not accept TTLs below %d seconds", ttl, name, minTTL)
+	}
+	return ttl, nil
+}
+
+// parseBool parses the boolean environment variable name, an unset variable is false
+func parseBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q in %s, must be true or false", value, name)
+	}
+	return b, nil
+}
+
+// splitList splits a comma-separated list, ignoring whitespace and empty entries
+func splitList(list string) []string {
+	var res []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
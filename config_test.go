@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{"", defaultTTL, false},
+		{"600", 600, false},
+		{"3600", 3600, false},
+		{"599", 0, true},
+		{"60", 0, true},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"10m", 0, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("GD_TTL_TEST", tt.value)
+		got, err := parseTTL("GD_TTL_TEST")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseTTL(%q) = %d, %v, want %d, wantErr %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// startControlServer serves the control API on GD_CONTROL_ADDR until ctx is canceled.
+// Every decision on a pending change is sent to trigger, so approved changes are written right away.
+func startControlServer(ctx context.Context, trigger chan<- struct{}) error {
+	listener, err := net.Listen("tcp", controlAddr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/approvals", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, "") {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pendingChanges())
+	})
+	//health needs no token, so the healthcheck command doesn't either
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(currentHealth())
+	})
+	//POST /approvals/<id>/approve and /approvals/<id>/reject
+	mux.HandleFunc("/approvals/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/approvals/"), "/")
+		if r.Method != http.MethodPost || len(parts) != 2 || (parts[1] != "approve" && parts[1] != "reject") {
+			http.NotFound(w, r)
+			return
+		}
+		//webhook callbacks authorize with the key of the change instead of the control token
+		key := r.URL.Query().Get("key")
+		if !authorized(r, key) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := decide(parts[0], key, parts[1] == "approve"); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Infof("Pending change %s was %sd through the control API", parts[0], parts[1])
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Control server stopped: %v", err)
+		}
+	}()
+	log.Infof("Serving control API on %s", controlAddr)
+	return nil
+}
+
+// authorized reports whether the request carries the control token, or key is set, which is then checked by decide
+func authorized(r *http.Request, key string) bool {
+	if key != "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(controlToken)) == 1
+}
+
+// runApprovals lists, approves or rejects pending changes through the control API of the running updater.
+// It returns the exit code for the approvals command.
+func runApprovals(args []string) int {
+	controlAddr = os.Getenv("GD_CONTROL_ADDR")
+	controlToken = os.Getenv("GD_CONTROL_TOKEN")
+	if controlAddr == "" || controlToken == "" {
+		fmt.Fprintln(os.Stderr, "GD_CONTROL_ADDR and GD_CONTROL_TOKEN of the running updater must be set")
+		return 1
+	}
+	base := "http://" + controlAddr
+	var req *http.Request
+	var err error
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		req, err = http.NewRequest("GET", base+"/approvals", nil)
+	case len(args) == 2 && (args[0] == "approve" || args[0] == "reject"):
+		req, err = http.NewRequest("POST", fmt.Sprintf("%s/approvals/%s/%s", base, args[1], args[0]), nil)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: approvals list | approvals approve <id> | approvals reject <id>")
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	req.Header.Set("Authorization", "Bearer "+controlToken)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reach the updater: %v\n", err)
+		return 1
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		fmt.Fprintf(os.Stderr, "Updater sent status code %d: %s\n", res.StatusCode, strings.TrimSpace(string(body)))
+		return 1
+	}
+	if args[0] != "list" {
+		fmt.Printf("Change %s %sd\n", args[1], args[0])
+		return 0
+	}
+	var changes []PendingChange
+	if err := json.Unmarshal(body, &changes); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse pending changes: %v\n", err)
+		return 1
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Created.Before(changes[j].Created) })
+	for _, pc := range changes {
+		status := "pending"
+		if pc.Approved {
+			status = "approved"
+		}
+		fmt.Printf("%s\t%s\t%s -> %s\t%s\t%s\t%s\n", pc.ID, pc.FQDN, describeValue(pc.OldValue), pc.NewValue,
+			pc.Created.Format(dateTimeFormat), status, pc.Reason)
+	}
+	return 0
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pbkdf2Iterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256
+const pbkdf2Iterations = 600000
+
+// machineIDFiles are tried in order to derive a key when no passphrase is configured
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// Credential holds the API credentials of one provider account
+type Credential struct {
+	Provider string `json:"provider"`
+	Key      string `json:"key"`
+	Secret   string `json:"secret"`
+}
+
+// credentialFile is the on-disk format of the credential store, Data holds the encrypted credentials
+type credentialFile struct {
+	Version    int    `json:"version"`
+	KeySource  string `json:"keySource"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// defaultCredentialsFile returns the credential store in the users config directory
+func defaultCredentialsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "go-ddns-credentials.json"
+	}
+	return filepath.Join(dir, "go-ddns", "credentials.json")
+}
+
+// storeSecret returns the secret the store key is derived from: the passphrase in GD_CREDENTIALS_PASSPHRASE or the
+// file in GD_CREDENTIALS_PASSPHRASE_FILE, or the machine id if neither is set
+func storeSecret() (secret []byte, source string, err error) {
+	if pass := os.Getenv("GD_CREDENTIALS_PASSPHRASE"); pass != "" {
+		return []byte(pass), "passphrase", nil
+	}
+	if path := os.Getenv("GD_CREDENTIALS_PASSPHRASE_FILE"); path != "" {
+		pass, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read passphrase file: %v", err)
+		}
+		return []byte(strings.TrimSpace(string(pass))), "passphrase", nil
+	}
+	for _, path := range machineIDFiles {
+		id, err := os.ReadFile(path)
+		if err == nil && len(strings.TrimSpace(string(id))) > 0 {
+			return []byte(strings.TrimSpace(string(id))), "machine", nil
+		}
+	}
+	return nil, "", errors.New("no passphrase (GD_CREDENTIALS_PASSPHRASE or GD_CREDENTIALS_PASSPHRASE_FILE) and no machine id found")
+}
+
+// loadCredentials decrypts the credential store at path, a missing store contains no credentials
+func loadCredentials(path string) (map[string]Credential, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]Credential), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file credentialFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse credential store: %v", err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("unsupported credential store version %d", file.Version)
+	}
+	secret, source, err := storeSecret()
+	if err != nil {
+		return nil, err
+	}
+	if source != file.KeySource {
+		return nil, fmt.Errorf("credential store is encrypted with a %s key, but a %s key is configured", file.KeySource, source)
+	}
+	gcm, err := newStoreCipher(secret, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt credential store, wrong passphrase or machine")
+	}
+	creds := make(map[string]Credential)
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted credentials: %v", err)
+	}
+	return creds, nil
+}
+
+// saveCredentials encrypts creds with a fresh salt and nonce and writes them to path, readable by the owner only
+func saveCredentials(path string, creds map[string]Credential) error {
+	secret, source, err := storeSecret()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	file := credentialFile{
+		Version:    1,
+		KeySource:  source,
+		Iterations: pbkdf2Iterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := newStoreCipher(secret, file.Salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, raw, 0600)
+}
+
+func newStoreCipher(secret, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2SHA256(secret, salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key of keyLen bytes from password as described in RFC 8018
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		_ = binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// vectors from RFC 7914 section 11 and the SHA-256 counterparts of the RFC 6070 vectors
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+		{"pass\x00word", "sa\x00lt", 4096, "89b69d0516f829893c696226650a8687"},
+	}
+	for _, tt := range tests {
+		want, _ := hex.DecodeString(tt.want)
+		got := pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, len(want))
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %x, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestCredentialStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-ddns", "credentials.json")
+	t.Setenv("GD_CREDENTIALS_PASSPHRASE", "correct horse battery staple")
+
+	creds, err := loadCredentials(path)
+	if err != nil || len(creds) != 0 {
+		t.Fatalf("loadCredentials() of a missing store = %v, %v, want an empty store", creds, err)
+	}
+	creds["home"] = Credential{Provider: "godaddy", Key: "key", Secret: "secret"}
+	if err := saveCredentials(path, creds); err != nil {
+		t.Fatalf("saveCredentials() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("credential store mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := loadCredentials(path)
+	if err != nil {
+		t.Fatalf("loadCredentials() error = %v", err)
+	}
+	if len(loaded) != 1 || loaded["home"] != creds["home"] {
+		t.Errorf("loadCredentials() = %v, want %v", loaded, creds)
+	}
+
+	t.Setenv("GD_CREDENTIALS_PASSPHRASE", "wrong")
+	if _, err := loadCredentials(path); err == nil {
+		t.Error("loadCredentials() with the wrong passphrase succeeded")
+	}
+}
+
+func TestCredentialStoreTightensMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	t.Setenv("GD_CREDENTIALS_PASSPHRASE", "correct horse battery staple")
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCredentials(path, map[string]Credential{"home": {Provider: "godaddy", Key: "key", Secret: "secret"}}); err != nil {
+		t.Fatalf("saveCredentials() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("credential store mode = %v after replacing a 0644 file, want 0600", info.Mode().Perm())
+	}
+}
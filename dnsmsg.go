@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNS record types and classes used by go-ddns
+const (
+	dnsTypeA     uint16 = 1
+	dnsTypeSOA   uint16 = 6
+	dnsTypePTR   uint16 = 12
+	dnsTypeTXT   uint16 = 16
+	dnsTypeAAAA  uint16 = 28
+	dnsTypeOPT   uint16 = 41
+	dnsTypeRRSIG uint16 = 46
+	dnsTypeTSIG  uint16 = 250
+
+	dnsClassIN  uint16 = 1
+	dnsClassCH  uint16 = 3
+	dnsClassANY uint16 = 255
+)
+
+// header flags, opcodes and response codes
+const (
+	dnsFlagQR uint16 = 1 << 15
+	dnsFlagTC uint16 = 1 << 9
+	dnsFlagRD uint16 = 1 << 8
+	dnsFlagAD uint16 = 1 << 5
+	dnsFlagCD uint16 = 1 << 4
+
+	dnsOpcodeUpdate = 5
+
+	dnsRcodeSuccess  = 0
+	dnsRcodeServFail = 2
+	dnsRcodeNXDomain = 3
+)
+
+var dnsRcodeNames = map[int]string{
+	1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+	6: "YXDOMAIN", 7: "YXRRSET", 8: "NXRRSET", 9: "NOTAUTH", 10: "NOTZONE",
+}
+
+type dnsQuestion struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+type dnsRR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	//Data is the raw RDATA, names in it are not decompressed
+	Data []byte
+}
+
+// dnsMessage is a DNS message with just enough of RFC 1035 for the queries and updates go-ddns sends
+type dnsMessage struct {
+	ID         uint16
+	Flags      uint16
+	Questions  []dnsQuestion
+	Answers    []dnsRR
+	Authority  []dnsRR
+	Additional []dnsRR
+
+	//raw is the message as received and tsigOffset where its TSIG record starts, 0 without one
+	raw        []byte
+	tsigOffset int
+}
+
+func (m *dnsMessage) rcode() int {
+	return int(m.Flags & 0xf)
+}
+
+// rcodeError returns an error for unsuccessful responses
+func (m *dnsMessage) rcodeError() error {
+	if m.rcode() == dnsRcodeSuccess {
+		return nil
+	}
+	if name, ok := dnsRcodeNames[m.rcode()]; ok {
+		return fmt.Errorf("server responded with %s", name)
+	}
+	return fmt.Errorf("server responded with rcode %d", m.rcode())
+}
+
+func (m *dnsMessage) pack() ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], m.Flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authority)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additional)))
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendDNSName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+	}
+	for _, section := range [][]dnsRR{m.Answers, m.Authority, m.Additional} {
+		for _, rr := range section {
+			if b, err = appendDNSName(b, rr.Name); err != nil {
+				return nil, err
+			}
+			b = binary.BigEndian.AppendUint16(b, rr.Type)
+			b = binary.BigEndian.AppendUint16(b, rr.Class)
+			b = binary.BigEndian.AppendUint32(b, rr.TTL)
+			b = binary.BigEndian.AppendUint16(b, uint16(len(rr.Data)))
+			b = append(b, rr.Data...)
+		}
+	}
+	return b, nil
+}
+
+// appendDNSName appends name in uncompressed wire format, lower-cased as TSIG and PTR targets expect it
+func appendDNSName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if name != "" {
+		if len(name) > 253 {
+			return nil, fmt.Errorf("name %s is too long", name)
+		}
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("invalid label in name %s", name)
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+var errDNSTruncated = errors.New("truncated DNS message")
+
+func unpackDNSMessage(b []byte) (*dnsMessage, error) {
+	if len(b) < 12 {
+		return nil, errDNSTruncated
+	}
+	m := &dnsMessage{
+		ID:    binary.BigEndian.Uint16(b[0:]),
+		Flags: binary.BigEndian.Uint16(b[2:]),
+		raw:   b,
+	}
+	off := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(b[4:])); i++ {
+		name, next, err := readDNSName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(b) {
+			return nil, errDNSTruncated
+		}
+		m.Questions = append(m.Questions, dnsQuestion{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[next:]),
+			Class: binary.BigEndian.Uint16(b[next+2:]),
+		})
+		off = next + 4
+	}
+	sections := []*[]dnsRR{&m.Answers, &m.Authority, &m.Additional}
+	for s, section := range sections {
+		count := int(binary.BigEndian.Uint16(b[6+2*s:]))
+		for i := 0; i < count; i++ {
+			start := off
+			name, next, err := readDNSName(b, off)
+			if err != nil {
+				return nil, err
+			}
+			if next+10 > len(b) {
+				return nil, errDNSTruncated
+			}
+			rr := dnsRR{
+				Name:  name,
+				Type:  binary.BigEndian.Uint16(b[next:]),
+				Class: binary.BigEndian.Uint16(b[next+2:]),
+				TTL:   binary.BigEndian.Uint32(b[next+4:]),
+			}
+			length := int(binary.BigEndian.Uint16(b[next+8:]))
+			off = next + 10 + length
+			if off > len(b) {
+				return nil, errDNSTruncated
+			}
+			rr.Data = b[next+10 : off]
+			//a TSIG record only counts as the last record of the additional section (RFC 8945 section 5.1)
+			if rr.Type == dnsTypeTSIG && s == len(sections)-1 && i == count-1 {
+				m.tsigOffset = start
+			}
+			*section = append(*section, rr)
+		}
+	}
+	return m, nil
+}
+
+// readDNSName reads the possibly compressed name at off and returns it with the offset after it
+func readDNSName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, errDNSTruncated
+		}
+		length := int(b[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, errDNSTruncated
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, errors.New("too many compression pointers in DNS message")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+		default:
+			if off+1+length > len(b) {
+				return "", 0, errDNSTruncated
+			}
+			labels = append(labels, string(b[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// newDNSID returns a random message ID
+func newDNSID() uint16 {
+	var b [2]byte
+	_, _ = rand.Read(b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
+
+// dnsExchange sends msg to server, a host with optional port, over udp or tcp and returns the response.
+// Truncated UDP responses are retried over TCP.
+func dnsExchange(ctx context.Context, network, server string, msg *dnsMessage) (*dnsMessage, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	query, err := msg.pack()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	var response []byte
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		response = buf[:n]
+	} else if response, err = exchangeStream(conn, query); err != nil {
+		return nil, err
+	}
+	res, err := unpackDNSMessage(response)
+	if err != nil {
+		return nil, err
+	}
+	if res.ID != msg.ID {
+		return nil, fmt.Errorf("DNS response from %s has mismatched ID", server)
+	}
+	if network == "udp" && res.Flags&dnsFlagTC != 0 {
+		return dnsExchange(ctx, "tcp", server, msg)
+	}
+	return res, nil
+}
+
+// exchangeStream writes query and reads the response with the two byte length prefix used over TCP and TLS
+func exchangeStream(conn io.ReadWriter, query []byte) ([]byte, error) {
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// dnsQuery sends q to the resolver with the DNSSEC OK bit set, so validating resolvers report the outcome in the AD
+// flag. checkingDisabled sets the CD flag, making the resolver answer even if validation fails.
+func dnsQuery(ctx context.Context, resolver *dnsResolver, q dnsQuestion, checkingDisabled bool) (*dnsMessage, error) {
+	msg := &dnsMessage{
+		ID:        newDNSID(),
+		Flags:     dnsFlagRD | dnsFlagAD,
+		Questions: []dnsQuestion{q},
+		//EDNS0 with a 1232 byte UDP payload and the DO bit
+		Additional: []dnsRR{{Name: ".", Type: dnsTypeOPT, Class: 1232, TTL: 1 << 15}},
+	}
+	if checkingDisabled {
+		msg.Flags |= dnsFlagCD
+	}
+	return resolver.exchange(ctx, msg)
+}
+
+// addresses returns the A and AAAA records in the answer
+func (m *dnsMessage) addresses() []string {
+	var res []string
+	for _, rr := range m.Answers {
+		if (rr.Type == dnsTypeA && len(rr.Data) == 4) || (rr.Type == dnsTypeAAAA && len(rr.Data) == 16) {
+			res = append(res, net.IP(rr.Data).String())
+		}
+	}
+	return res
+}
+
+// signed reports whether the answer carries RRSIG records
+func (m *dnsMessage) signed() bool {
+	for _, rr := range m.Answers {
+		if rr.Type == dnsTypeRRSIG {
+			return true
+		}
+	}
+	return false
+}
+
+// texts returns the first string of every TXT record in the answer
+func (m *dnsMessage) texts() []string {
+	var res []string
+	for _, rr := range m.Answers {
+		if rr.Type == dnsTypeTXT && len(rr.Data) > 0 && int(rr.Data[0]) < len(rr.Data) {
+			res = append(res, string(rr.Data[1:1+int(rr.Data[0])]))
+		}
+	}
+	return res
+}
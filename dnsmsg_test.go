@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDNSMessageRoundTrip(t *testing.T) {
+	msg := &dnsMessage{
+		ID:        0xbeef,
+		Flags:     dnsFlagQR | dnsFlagRD | dnsFlagAD,
+		Questions: []dnsQuestion{{Name: "home.example.com.", Type: dnsTypeA, Class: dnsClassIN}},
+		Answers: []dnsRR{
+			{Name: "home.example.com.", Type: dnsTypeA, Class: dnsClassIN, TTL: 600, Data: []byte{192, 0, 2, 1}},
+			{Name: "home.example.com.", Type: dnsTypeTXT, Class: dnsClassIN, TTL: 60, Data: []byte("\x09192.0.2.1")},
+		},
+		Authority:  []dnsRR{{Name: "example.com.", Type: dnsTypeSOA, Class: dnsClassIN, TTL: 3600, Data: []byte{}}},
+		Additional: []dnsRR{{Name: ".", Type: dnsTypeOPT, Class: 1232, TTL: 1 << 15, Data: []byte{}}},
+	}
+	packed, err := msg.pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unpackDNSMessage(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.raw = nil
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("unpackDNSMessage(pack()) = %+v, want %+v", got, msg)
+	}
+	if addrs := got.addresses(); !reflect.DeepEqual(addrs, []string{"192.0.2.1"}) {
+		t.Errorf("addresses() = %v", addrs)
+	}
+	if texts := got.texts(); !reflect.DeepEqual(texts, []string{"192.0.2.1"}) {
+		t.Errorf("texts() = %v", texts)
+	}
+}
+
+func TestAppendDNSName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{".", "\x00", false},
+		{"", "\x00", false},
+		{"Example.COM.", "\x07example\x03com\x00", false},
+		{"a..b", "", true},
+		{"x." + string(make([]byte, 64)), "", true},
+	}
+	for _, tt := range tests {
+		got, err := appendDNSName(nil, tt.name)
+		if (err != nil) != tt.wantErr || string(got) != tt.want {
+			t.Errorf("appendDNSName(%q) = %q, %v, want %q, wantErr %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadDNSName(t *testing.T) {
+	//example.com at 12, www pointing to it at 25, a pointer to itself at 31 and a pointer beyond the end at 33
+	msg := []byte("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00" +
+		"\x07example\x03com\x00" +
+		"\x03www\xc0\x0c" +
+		"\xc0\x1f" +
+		"\xc0\xff")
+	tests := []struct {
+		name     string
+		off      int
+		want     string
+		wantNext int
+		wantErr  bool
+	}{
+		{"plain", 12, "example.com.", 25, false},
+		{"compressed", 25, "www.example.com.", 31, false},
+		{"pointer loop", 31, "", 0, true},
+		{"pointer out of range", 33, "", 0, true},
+		{"truncated label", 25, "", 0, true},
+		{"truncated pointer", 29, "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := msg
+			switch tt.name {
+			case "truncated label":
+				b = msg[:27]
+			case "truncated pointer":
+				b = msg[:30]
+			}
+			got, next, err := readDNSName(b, tt.off)
+			if (err != nil) != tt.wantErr || got != tt.want || next != tt.wantNext {
+				t.Errorf("readDNSName(%d) = %q, %d, %v, want %q, %d, wantErr %v", tt.off, got, next, err, tt.want, tt.wantNext, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnpackDNSMessageTruncated(t *testing.T) {
+	msg := &dnsMessage{
+		ID:        1,
+		Questions: []dnsQuestion{{Name: "example.com", Type: dnsTypeA, Class: dnsClassIN}},
+		Answers:   []dnsRR{{Name: "example.com", Type: dnsTypeA, Class: dnsClassIN, TTL: 600, Data: []byte{192, 0, 2, 1}}},
+	}
+	packed, err := msg.pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < len(packed); n++ {
+		if _, err := unpackDNSMessage(packed[:n]); err == nil {
+			t.Errorf("unpackDNSMessage() of the first %d of %d bytes succeeded", n, len(packed))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// doctorTimeout bounds the whole doctor run so a hanging endpoint can't block it forever
+const doctorTimeout = time.Minute
+
+// doctorReport collects the results of all doctor checks
+type doctorReport struct {
+	failed bool
+}
+
+func (r *doctorReport) check(name string, err error) {
+	if err != nil {
+		r.failed = true
+		fmt.Printf("[FAIL] %s: %v\n", name, err)
+		return
+	}
+	fmt.Printf("[PASS] %s\n", name)
+}
+
+// runDoctor checks the configuration, IP sources and godaddy access and prints a pass/fail report.
+// It returns the exit code for the doctor command.
+func runDoctor() int {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	var report doctorReport
+
+	err := loadConfig()
+	report.check("configuration", err)
+	if err != nil {
+		//without credentials and domains there is nothing else we can check
+		return 1
+	}
+
+	for _, domain := range domains {
+		for _, name := range recordNames {
+			fqdn := recordFQDN(name, domain)
+			report.check("write policy for "+fqdn, checkPolicy(fqdn))
+		}
+	}
+	for _, source := range ipSources {
+		report.check("IP source "+source, checkIPSource(ctx, source))
+	}
+	checkRecordSources(ctx, &report)
+
+	err = checkGodaddyAuth(ctx)
+	report.check("godaddy authentication", err)
+	if err == nil {
+		for _, domain := range domains {
+			report.check("domain "+domain, checkGodaddyDomain(ctx, domain))
+		}
+	}
+
+	if report.failed {
+		return 1
+	}
+	return 0
+}
+
+// checkIPSource resolves the host of an IP source and gets the public IP address from it
+func checkIPSource(ctx context.Context, source string) error {
+	if !strings.HasPrefix(source, "dns:") {
+		u, err := url.Parse(source)
+		if err != nil {
+			return fmt.Errorf("invalid URL: %v", err)
+		}
+		if _, err := net.DefaultResolver.LookupHost(ctx, u.Hostname()); err != nil {
+			return fmt.Errorf("failed to resolve %s: %v", u.Hostname(), err)
+		}
+	}
+	ip, err := getIPAddressFromSource(ctx, source)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("       %s reports %s\n", source, ip)
+	return nil
+}
+
+// checkRecordSources gets the address of every non-public source used by a record in the configuration file
+func checkRecordSources(ctx context.Context, report *doctorReport) {
+	checked := make(map[string]bool)
+	for fqdn, rc := range fileConfig.Records {
+		kind, arg, _ := parseSource(rc.Source)
+		if kind == sourcePublic {
+			continue
+		}
+		key := rc.Source + "/" + rc.recordType()
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		var addr string
+		var err error
+		if kind == sourceInterface {
+			addr, err = interfaceAddress(arg, rc.recordType())
+		} else {
+			addr, err = tailscaleAddress(ctx, arg, rc.recordType())
+		}
+		if err == nil {
+			fmt.Printf("       %s reports %s for %s records (e.g. %s)\n", rc.Source, addr, rc.recordType(), fqdn)
+		}
+		report.check(fmt.Sprintf("record source %s (%s)", rc.Source, rc.recordType()), err)
+	}
+}
+
+// checkGodaddyAuth authenticates against godaddy by listing the domains of the account
+func checkGodaddyAuth(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", GodaddyApiBase+"?limit=1", nil)
+	if err != nil {
+		return err
+	}
+	_, err = doGodaddyRequest(req)
+	if errorKind(err) == ErrorKindAuth {
+		return fmt.Errorf("credentials were rejected, check GD_API_KEY and GD_API_SECRET: %v", err)
+	}
+	return err
+}
+
+// checkGodaddyDomain confirms the domain belongs to the account, is active and its A records can be read
+func checkGodaddyDomain(ctx context.Context, domain string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", GodaddyApiBase+"/"+domain, nil)
+	if err != nil {
+		return err
+	}
+	body, err := doGodaddyRequest(req)
+	if errorKind(err) == ErrorKindNotFound {
+		return fmt.Errorf("domain is not part of this godaddy account")
+	}
+	if err != nil {
+		return err
+	}
+	var details struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &details); err != nil {
+		return fmt.Errorf("failed to parse domain details: %v", err)
+	}
+	if details.Status != "ACTIVE" {
+		return fmt.Errorf("domain status is %s", details.Status)
+	}
+	if _, err := getDomainRecords(ctx, domain, "A"); err != nil {
+		return fmt.Errorf("failed to read A records: %v", err)
+	}
+	return nil
+}
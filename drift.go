@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// policies for records that were changed by someone else, set through GD_DRIFT_POLICY
+const (
+	//driftPolicyOverwrite writes the detected IP anyway, this is the default
+	driftPolicyOverwrite = "overwrite"
+	//driftPolicyAlert leaves the record alone and notifies about the change
+	driftPolicyAlert = "alert"
+	//driftPolicyAdopt accepts the new value until the detected IP changes
+	driftPolicyAdopt = "adopt"
+)
+
+// handleDrift detects whether a record was changed outside of go-ddns since we last wrote it, i.e. its value differs
+// both from what we wrote and from the detected IP, and applies GD_DRIFT_POLICY.
+// It reports whether the record has to be left alone in this update.
+func handleDrift(ctx context.Context, domain, fqdn string, values []string, currentIpAddr string) bool {
+	rs := state.record(fqdn)
+	//all values of the record count, a record with our value and a foreign one was changed as well
+	current := strings.Join(values, ",")
+	ours := sameValues(values, splitList(rs.Value))
+
+	if rs.Value == "" || ours || sameValues(values, []string{currentIpAddr}) {
+		rs.Drifted = ""
+		//an adopted value is kept for as long as the detected IP stays the same
+		if rs.AdoptedFor != "" && rs.AdoptedFor == currentIpAddr && ours {
+			log.Infof("Keeping adopted value %s for %s", describeValue(current), fqdn)
+			return true
+		}
+		rs.AdoptedFor = ""
+		return false
+	}
+
+	msg := fmt.Sprintf("%s was changed outside of go-ddns, expected %s but found %s", fqdn, rs.Value, describeValue(current))
+	switch driftPolicy {
+	case driftPolicyAlert:
+		log.Warnf("%s, leaving it alone", msg)
+		//only notify once per foreign value
+		if rs.Drifted != describeValue(current) {
+			rs.Drifted = describeValue(current)
+			notify(ctx, "drift", domain, msg+", leaving it alone")
+		}
+		return true
+	case driftPolicyAdopt:
+		log.Warnf("%s, adopting it until the IP address changes", msg)
+		notify(ctx, "drift", domain, msg+", adopting it until the IP address changes")
+		rs.Value = current
+		rs.AdoptedFor = currentIpAddr
+		rs.Drifted = ""
+		return true
+	default:
+		log.Warnf("%s, overwriting it", msg)
+		notify(ctx, "drift", domain, msg+", overwriting it")
+		return false
+	}
+}
+
+func describeValue(value string) string {
+	if value == "" {
+		return "(deleted)"
+	}
+	return value
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// driftStep is a single update of www.example.com: the values found in the zone and the detected IP
+type driftStep struct {
+	values    []string
+	detected  string
+	wantAlone bool
+	//wantValue is the value remembered for the record afterwards
+	wantValue string
+	//wantNotified is the number of notifications sent so far
+	wantNotified int
+}
+
+func TestHandleDrift(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		steps  []driftStep
+	}{
+		{"overwrite", driftPolicyOverwrite, []driftStep{
+			{[]string{"192.0.2.1"}, "192.0.2.1", false, "192.0.2.1", 0},
+			{[]string{"198.51.100.9"}, "192.0.2.1", false, "192.0.2.1", 1},
+			//every update finds the foreign value again until it is overwritten
+			{[]string{"198.51.100.9"}, "192.0.2.1", false, "192.0.2.1", 2},
+		}},
+		{"alert", driftPolicyAlert, []driftStep{
+			{[]string{"198.51.100.9"}, "192.0.2.1", true, "192.0.2.1", 1},
+			{[]string{"198.51.100.9"}, "192.0.2.1", true, "192.0.2.1", 1},
+			{[]string{"198.51.100.10"}, "192.0.2.1", true, "192.0.2.1", 2},
+			//a foreign value next to ours is a change as well
+			{[]string{"192.0.2.1", "198.51.100.10"}, "192.0.2.1", true, "192.0.2.1", 3},
+			{[]string{"192.0.2.1"}, "192.0.2.1", false, "192.0.2.1", 3},
+			{[]string{"198.51.100.9"}, "192.0.2.1", true, "192.0.2.1", 4},
+		}},
+		{"alert on the detected IP", driftPolicyAlert, []driftStep{
+			//someone else already published the new IP, that's no drift
+			{[]string{"192.0.2.2"}, "192.0.2.2", false, "192.0.2.1", 0},
+		}},
+		{"adopt until the IP changes", driftPolicyAdopt, []driftStep{
+			{[]string{"198.51.100.9"}, "192.0.2.1", true, "198.51.100.9", 1},
+			{[]string{"198.51.100.9"}, "192.0.2.1", true, "198.51.100.9", 1},
+			//the IP changed, so the record is managed again and gets the new IP
+			{[]string{"198.51.100.9"}, "192.0.2.2", false, "198.51.100.9", 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(s *State, dp, url string) { state, driftPolicy, notifyURL = s, dp, url }(state, driftPolicy, notifyURL)
+			state = newState()
+			driftPolicy = tt.policy
+			notifyURL = "https://hooks.example.com/goddns"
+			fake := installFakeGodaddy(t, nil)
+			state.record("www.example.com").Value = "192.0.2.1"
+
+			for i, step := range tt.steps {
+				alone := handleDrift(context.Background(), "example.com", "www.example.com", step.values, step.detected)
+				rs := state.record("www.example.com")
+				if alone != step.wantAlone || rs.Value != step.wantValue {
+					t.Errorf("step %d: handleDrift(%v, %s) = %v with value %s, want %v with value %s",
+						i, step.values, step.detected, alone, rs.Value, step.wantAlone, step.wantValue)
+				}
+				if len(fake.requests) != step.wantNotified {
+					t.Errorf("step %d: %d notifications sent, want %d", i, len(fake.requests), step.wantNotified)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleDriftAdoptThenManaged(t *testing.T) {
+	defer func(s *State, dp string) { state, driftPolicy = s, dp }(state, driftPolicy)
+	state = newState()
+	driftPolicy = driftPolicyAdopt
+	rs := state.record("www.example.com")
+	rs.Value = "192.0.2.1"
+	ctx := context.Background()
+
+	if !handleDrift(ctx, "example.com", "www.example.com", []string{"198.51.100.9"}, "192.0.2.1") {
+		t.Fatal("foreign value was not adopted")
+	}
+	if rs.AdoptedFor != "192.0.2.1" {
+		t.Fatalf("adopted for %q, want 192.0.2.1", rs.AdoptedFor)
+	}
+	if handleDrift(ctx, "example.com", "www.example.com", []string{"198.51.100.9"}, "192.0.2.2") {
+		t.Fatal("adopted value was kept after the IP changed")
+	}
+	if rs.AdoptedFor != "" {
+		t.Errorf("adopted for %q after the IP changed, want it cleared", rs.AdoptedFor)
+	}
+	//we wrote the new IP, from now on the record is ours again and a foreign change is adopted anew
+	rs.Value = "192.0.2.2"
+	if handleDrift(ctx, "example.com", "www.example.com", []string{"192.0.2.2"}, "192.0.2.2") {
+		t.Error("record we wrote is left alone")
+	}
+	if !handleDrift(ctx, "example.com", "www.example.com", []string{"198.51.100.10"}, "192.0.2.2") {
+		t.Error("foreign change after the record was managed again was not adopted")
+	}
+	if rs.Value != "198.51.100.10" || rs.AdoptedFor != "192.0.2.2" {
+		t.Errorf("state after adopting again = %s for %s, want 198.51.100.10 for 192.0.2.2", rs.Value, rs.AdoptedFor)
+	}
+}
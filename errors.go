@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies errors returned by the godaddy API so callers can decide whether to retry or notify
+type ErrorKind int
+
+const (
+	ErrorKindUnknown ErrorKind = iota
+	ErrorKindAuth
+	ErrorKindNotFound
+	ErrorKindRateLimited
+	ErrorKindValidation
+	ErrorKindTransient
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindAuth:
+		return "auth"
+	case ErrorKindNotFound:
+		return "not-found"
+	case ErrorKindRateLimited:
+		return "rate-limited"
+	case ErrorKindValidation:
+		return "validation"
+	case ErrorKindTransient:
+		return "transient"
+	default:
+		return "unknown"
+	}
+}
+
+// GodaddyErrorField is a single field level error reported by godaddy
+type GodaddyErrorField struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Path    string `json:"path"`
+}
+
+// GodaddyError is returned for every failed call to the godaddy API
+type GodaddyError struct {
+	Kind       ErrorKind
+	StatusCode int
+	//Code, Message and Fields are taken from the error body godaddy sends, if any
+	Code    string
+	Message string
+	Fields  []GodaddyErrorField
+	//RetryAfter is the time godaddy asked us to wait before retrying a rate limited request
+	RetryAfter time.Duration
+	//Err is the underlying error for failures that never got a response, e.g. network errors
+	Err error
+}
+
+func (e *GodaddyError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s error talking to godaddy: %v", e.Kind, e.Err)
+	}
+	msg := fmt.Sprintf("%s error from godaddy (status %d", e.Kind, e.StatusCode)
+	if e.Code != "" {
+		msg += ", code " + e.Code
+	}
+	msg += ")"
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if len(e.Fields) > 0 {
+		fields := make([]string, 0, len(e.Fields))
+		for _, field := range e.Fields {
+			fields = append(fields, fmt.Sprintf("%s: %s", field.Path, field.Message))
+		}
+		msg += " [" + strings.Join(fields, "; ") + "]"
+	}
+	return msg
+}
+
+func (e *GodaddyError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the failed call may succeed when repeated
+func (e *GodaddyError) Retryable() bool {
+	return e.Kind == ErrorKindTransient || e.Kind == ErrorKindRateLimited
+}
+
+// errorKind returns the kind of the first GodaddyError in err's chain, or ErrorKindUnknown if there is none
+func errorKind(err error) ErrorKind {
+	var gdErr *GodaddyError
+	if errors.As(err, &gdErr) {
+		return gdErr.Kind
+	}
+	return ErrorKindUnknown
+}
+
+// isRetryable reports whether err is a GodaddyError that may succeed when repeated
+func isRetryable(err error) bool {
+	var gdErr *GodaddyError
+	return errors.As(err, &gdErr) && gdErr.Retryable()
+}
+
+// newGodaddyError builds a GodaddyError from a non-ok response and its already read body
+func newGodaddyError(res *http.Response, body []byte) *GodaddyError {
+	gdErr := &GodaddyError{
+		Kind:       kindForStatus(res.StatusCode),
+		StatusCode: res.StatusCode,
+	}
+	var parsed struct {
+		Code          string              `json:"code"`
+		Message       string              `json:"message"`
+		Fields        []GodaddyErrorField `json:"fields"`
+		RetryAfterSec int                 `json:"retryAfterSec"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		//not one of godaddys error bodies, keep the raw body so we don't lose any information
+		gdErr.Message = strings.TrimSpace(string(body))
+	} else {
+		gdErr.Code = parsed.Code
+		gdErr.Message = parsed.Message
+		gdErr.Fields = parsed.Fields
+		gdErr.RetryAfter = time.Duration(parsed.RetryAfterSec) * time.Second
+	}
+	if gdErr.RetryAfter == 0 {
+		if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			gdErr.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+	return gdErr
+}
+
+func kindForStatus(status int) ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorKindAuth
+	case status == http.StatusNotFound:
+		return ErrorKindNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrorKindRateLimited
+	case status == http.StatusBadRequest || status == http.StatusConflict || status == http.StatusUnprocessableEntity:
+		return ErrorKindValidation
+	case status == http.StatusRequestTimeout || status >= 500:
+		return ErrorKindTransient
+	default:
+		return ErrorKindUnknown
+	}
+}
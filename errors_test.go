@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKindForStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   ErrorKind
+	}{
+		{http.StatusUnauthorized, ErrorKindAuth},
+		{http.StatusForbidden, ErrorKindAuth},
+		{http.StatusNotFound, ErrorKindNotFound},
+		{http.StatusTooManyRequests, ErrorKindRateLimited},
+		{http.StatusBadRequest, ErrorKindValidation},
+		{http.StatusConflict, ErrorKindValidation},
+		{http.StatusUnprocessableEntity, ErrorKindValidation},
+		{http.StatusRequestTimeout, ErrorKindTransient},
+		{http.StatusInternalServerError, ErrorKindTransient},
+		{http.StatusGatewayTimeout, ErrorKindTransient},
+		{http.StatusTeapot, ErrorKindUnknown},
+		{http.StatusMovedPermanently, ErrorKindUnknown},
+	}
+	for _, tt := range tests {
+		if got := kindForStatus(tt.status); got != tt.want {
+			t.Errorf("kindForStatus(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestNewGodaddyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		want       GodaddyError
+	}{
+		{
+			name:   "validation body",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"code":"INVALID_BODY","message":"Request body doesn't fulfill schema","fields":[{"code":"UNEXPECTED_TYPE","message":"is not a string","path":"records[0].data"}]}`,
+			want: GodaddyError{Kind: ErrorKindValidation, StatusCode: 422, Code: "INVALID_BODY",
+				Message: "Request body doesn't fulfill schema",
+				Fields:  []GodaddyErrorField{{Code: "UNEXPECTED_TYPE", Message: "is not a string", Path: "records[0].data"}}},
+		},
+		{
+			name:   "retry after in body",
+			status: http.StatusTooManyRequests,
+			body:   `{"code":"TOO_MANY_REQUESTS","message":"Too many requests","retryAfterSec":30}`,
+			want: GodaddyError{Kind: ErrorKindRateLimited, StatusCode: 429, Code: "TOO_MANY_REQUESTS",
+				Message: "Too many requests", RetryAfter: 30 * time.Second},
+		},
+		{
+			name:       "retry after header",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "12",
+			body:       `{"code":"TOO_MANY_REQUESTS","message":"Too many requests"}`,
+			want: GodaddyError{Kind: ErrorKindRateLimited, StatusCode: 429, Code: "TOO_MANY_REQUESTS",
+				Message: "Too many requests", RetryAfter: 12 * time.Second},
+		},
+		{
+			name:       "body wins over header",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "12",
+			body:       `{"retryAfterSec":30}`,
+			want:       GodaddyError{Kind: ErrorKindRateLimited, StatusCode: 429, RetryAfter: 30 * time.Second},
+		},
+		{
+			name:       "retry after date is ignored",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT",
+			want:       GodaddyError{Kind: ErrorKindRateLimited, StatusCode: 429},
+		},
+		{
+			name:   "raw body",
+			status: http.StatusBadGateway,
+			body:   "<html>Bad Gateway</html>\n",
+			want:   GodaddyError{Kind: ErrorKindTransient, StatusCode: 502, Message: "<html>Bad Gateway</html>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				res.Header.Set("Retry-After", tt.retryAfter)
+			}
+			got := newGodaddyError(res, []byte(tt.body))
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("newGodaddyError() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
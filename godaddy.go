@@ -4,87 +4,142 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	log "github.com/sirupsen/logrus"
 	"io"
 	"net/http"
+	"time"
 )
 
 const GodaddyBaseUrl = "https://api.godaddy.com"
 const GodaddyApiBase = GodaddyBaseUrl + "/v1/domains"
 
-type GodaddyGetDNSRecordResponse struct {
-	Data string `json:"data"`
-	Name string `json:"name"`
-}
+// maxAttempts is how often a retryable godaddy call is attempted before giving up until the next update
+const maxAttempts = 3
+
+// retryBackoff is the wait after the first failed attempt, it grows linearly with every further attempt
+var retryBackoff = 2 * time.Second
 
-type GodaddySetDNSRecordRequest struct {
+// GodaddyDNSRecord is a single DNS record as returned and accepted by the godaddy records endpoints
+type GodaddyDNSRecord struct {
 	Data string `json:"data"`
-	TTL  uint64 `json:"ttl"`
+	//Name is left out of the body of single-name calls, the name is part of their URL
+	Name string `json:"name,omitempty"`
+	TTL  uint64 `json:"ttl,omitempty"`
 }
 
-func getDomainAtRecordIP(ctx context.Context, domain string) (string, error) {
-	//prepare request
-	url := fmt.Sprintf("%s/%s/records/A/@", GodaddyApiBase, domain)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Add("Authorization", getGDAuthHeader())
-	httpRes, err := httpClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	//read body
-	httpResBytes, err := io.ReadAll(httpRes.Body)
+// getDomainRecords gets all records of the given type in the zone of domain
+func getDomainRecords(ctx context.Context, domain, recordType string) ([]GodaddyDNSRecord, error) {
+	url := fmt.Sprintf("%s/%s/records/%s", GodaddyApiBase, domain, recordType)
+	var res []GodaddyDNSRecord
+	err := withRetry(ctx, func() error {
+		//prepare request
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		body, err := doGodaddyRequest(req)
+		if err != nil {
+			return err
+		}
+		//parse body
+		return json.Unmarshal(body, &res)
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return res, nil
+}
 
-	if httpRes.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("godaddy sent non-ok status code %d, body: %s", httpRes.StatusCode, string(httpResBytes))
-	}
-	//parse body
-	var res []GodaddyGetDNSRecordResponse
-	err = json.Unmarshal(httpResBytes, &res)
-	if err != nil {
-		return "", err
-	}
+// setDomainRecord replaces all records of the given type and name in the zone of domain
+func setDomainRecord(ctx context.Context, domain, recordType, name string, records []GodaddyDNSRecord) error {
+	url := fmt.Sprintf("%s/%s/records/%s/%s", GodaddyApiBase, domain, recordType, name)
+	return putRecords(ctx, url, records)
+}
 
-	return res[0].Data, nil
+// setDomainRecords replaces all records of the given type in the zone of domain in a single call.
+// Records of that type which are missing from records are deleted by godaddy, so callers have to pass the full set.
+func setDomainRecords(ctx context.Context, domain, recordType string, records []GodaddyDNSRecord) error {
+	url := fmt.Sprintf("%s/%s/records/%s", GodaddyApiBase, domain, recordType)
+	return putRecords(ctx, url, records)
 }
 
-func setDomainAtRecord(ctx context.Context, domain, ip string) error {
-	//prepare body
-	var body bytes.Buffer
-	err := json.NewEncoder(&body).Encode([]GodaddySetDNSRecordRequest{
-		{
-			Data: ip,
-			TTL:  600,
-		},
+// deleteDomainRecord deletes all records of the given type and name in the zone of domain
+func deleteDomainRecord(ctx context.Context, domain, recordType, name string) error {
+	url := fmt.Sprintf("%s/%s/records/%s/%s", GodaddyApiBase, domain, recordType, name)
+	return withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+		if err != nil {
+			return err
+		}
+		_, err = doGodaddyRequest(req)
+		return err
 	})
+}
+
+func putRecords(ctx context.Context, url string, records []GodaddyDNSRecord) error {
+	//prepare body
+	payload, err := json.Marshal(records)
 	if err != nil {
 		return err
 	}
-	//prepare request
-	url := fmt.Sprintf("%s/%s/records/A/@", GodaddyApiBase, domain)
-	req, err := http.NewRequestWithContext(ctx, "PUT", url, &body)
-	if err != nil {
+	return withRetry(ctx, func() error {
+		//prepare request
+		req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		_, err = doGodaddyRequest(req)
 		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
+	})
+}
+
+// doGodaddyRequest authenticates and sends req and returns the response body.
+// Every failure, including network errors, is returned as a *GodaddyError unless the context was canceled.
+func doGodaddyRequest(req *http.Request) ([]byte, error) {
 	req.Header.Set("Authorization", getGDAuthHeader())
 	res, err := httpClient.Do(req)
 	if err != nil {
-		return nil
+		if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+		return nil, &GodaddyError{Kind: ErrorKindTransient, Err: err}
 	}
-	if res.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(res.Body)
-		if err != nil {
-			return fmt.Errorf("received non-ok status code %d from godaddy, but failed to read body: %v", res.StatusCode, err)
+	defer res.Body.Close()
+	//read body
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &GodaddyError{Kind: ErrorKindTransient, StatusCode: res.StatusCode, Err: err}
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, newGodaddyError(res, body)
+	}
+	return body, nil
+}
+
+// withRetry calls f until it succeeds, returns a non retryable error or maxAttempts is reached.
+// Rate limited calls wait as long as godaddy asks us to, everything else backs off linearly.
+func withRetry(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || !isRetryable(err) || attempt == maxAttempts {
+			return err
+		}
+		wait := time.Duration(attempt) * retryBackoff
+		var gdErr *GodaddyError
+		if errors.As(err, &gdErr) && gdErr.RetryAfter > wait {
+			wait = gdErr.RetryAfter
+		}
+		log.Debugf("Retrying godaddy call in %v after attempt %d failed: %v", wait, attempt, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
 		}
-		return fmt.Errorf("received non-ok status code %d from godaddy, body: %s", res.StatusCode, string(body))
 	}
-	return nil
 }
 
 func getGDAuthHeader() string {
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGodaddy answers godaddy API calls from an in-memory zone and records every request
+type fakeGodaddy struct {
+	mu sync.Mutex
+	//zone holds the records of every type, keyed by type
+	zone     map[string][]GodaddyDNSRecord
+	requests []string
+	bodies   []string
+}
+
+// installFakeGodaddy sends all requests of httpClient to a fake godaddy for the duration of the test
+func installFakeGodaddy(t *testing.T, zone map[string][]GodaddyDNSRecord) *fakeGodaddy {
+	t.Helper()
+	fake := &fakeGodaddy{zone: zone}
+	transport := httpClient.Transport
+	httpClient.Transport = fake
+	t.Cleanup(func() { httpClient.Transport = transport })
+	return fake
+}
+
+func (f *fakeGodaddy) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	f.requests = append(f.requests, req.Method+" "+req.URL.Path)
+	f.bodies = append(f.bodies, string(body))
+	//paths are /v1/domains/<domain>/records/<type>[/<name>]
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/v1/domains/"), "/")
+	res := []byte("[]")
+	if len(parts) >= 3 && parts[1] == "records" {
+		recordType := parts[2]
+		switch {
+		case req.Method == "GET":
+			res, _ = json.Marshal(f.zone[recordType])
+		case req.Method == "PUT" && len(parts) == 3:
+			var records []GodaddyDNSRecord
+			_ = json.Unmarshal(body, &records)
+			f.zone[recordType] = records
+		case len(parts) == 4:
+			var records []GodaddyDNSRecord
+			if req.Method == "PUT" {
+				_ = json.Unmarshal(body, &records)
+			}
+			kept := replaceRecords(f.zone[recordType], map[string]bool{parts[3]: true}, nil)
+			for _, r := range records {
+				kept = append(kept, GodaddyDNSRecord{Data: r.Data, Name: parts[3], TTL: r.TTL})
+			}
+			f.zone[recordType] = kept
+		}
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(res)), Header: http.Header{}, Request: req}, nil
+}
+
+func TestSetDomainRecordBody(t *testing.T) {
+	fake := installFakeGodaddy(t, map[string][]GodaddyDNSRecord{"A": nil})
+	err := setDomainRecord(context.Background(), "example.com", "A", "www", []GodaddyDNSRecord{{Data: "192.0.2.1", TTL: 600}})
+	if err != nil {
+		t.Fatalf("setDomainRecord() error = %v", err)
+	}
+	if want := `[{"data":"192.0.2.1","ttl":600}]`; len(fake.bodies) != 1 || fake.bodies[0] != want {
+		t.Errorf("setDomainRecord() sent %q, want %q", fake.bodies, want)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	backoff := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = backoff })
+	transient := &GodaddyError{Kind: ErrorKindTransient}
+	validation := &GodaddyError{Kind: ErrorKindValidation}
+	auth := &GodaddyError{Kind: ErrorKindAuth}
+	rateLimited := &GodaddyError{Kind: ErrorKindRateLimited, RetryAfter: 50 * time.Millisecond}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+		minWait   time.Duration
+	}{
+		{"success", []error{nil}, 1, nil, 0},
+		{"transient then success", []error{transient, nil}, 2, nil, 0},
+		{"gives up after max attempts", []error{transient, transient, transient, nil}, maxAttempts, transient, 0},
+		{"validation is not retried", []error{validation, nil}, 1, validation, 0},
+		{"auth is not retried", []error{auth, nil}, 1, auth, 0},
+		{"other errors are not retried", []error{io.ErrUnexpectedEOF, nil}, 1, io.ErrUnexpectedEOF, 0},
+		{"waits for retry after", []error{rateLimited, nil}, 2, nil, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			start := time.Now()
+			err := withRetry(context.Background(), func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("withRetry() called f %d times, want %d", calls, tt.wantCalls)
+			}
+			if err != tt.wantErr {
+				t.Errorf("withRetry() error = %v, want %v", err, tt.wantErr)
+			}
+			if waited := time.Since(start); waited < tt.minWait {
+				t.Errorf("withRetry() returned after %v, want at least %v", waited, tt.minWait)
+			}
+		})
+	}
+}
+
+func TestWithRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := withRetry(ctx, func() error {
+		calls++
+		return &GodaddyError{Kind: ErrorKindTransient}
+	})
+	if calls != 1 || errorKind(err) != ErrorKindTransient {
+		t.Errorf("withRetry() with canceled context = %v after %d calls, want the first error", err, calls)
+	}
+}
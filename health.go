@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Health tells whether the updater is still doing its job
+type Health struct {
+	//LastRun is when the last update finished, LastSuccess when the last one without any error did
+	LastRun     time.Time `json:"lastRun"`
+	LastSuccess time.Time `json:"lastSuccess"`
+}
+
+// currentHealth returns the health of this updater
+func currentHealth() Health {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return state.Health
+}
+
+// recordRun remembers when an update finished and whether it succeeded
+func recordRun(ok bool) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state.Health.LastRun = time.Now()
+	if ok {
+		state.Health.LastSuccess = state.Health.LastRun
+	}
+}
+
+// runHealthcheck exits non-zero if the last successful update of the running updater is older than GD_HEALTH_MAX_AGE,
+// three update intervals by default. It reads GD_STATE_FILE or asks the control API in GD_CONTROL_ADDR, so it works
+// as a docker HEALTHCHECK without any tools in the image.
+func runHealthcheck() int {
+	interval, err := time.ParseDuration(os.Getenv("GD_INTERVAL"))
+	if err != nil {
+		interval = defaultInterval
+	}
+	maxAge := 3 * interval
+	if value := os.Getenv("GD_HEALTH_MAX_AGE"); value != "" {
+		if maxAge, err = time.ParseDuration(value); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid GD_HEALTH_MAX_AGE: %v\n", err)
+			return 1
+		}
+	}
+	health, err := readHealth()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the health of the updater: %v\n", err)
+		return 1
+	}
+	if health.LastSuccess.IsZero() {
+		fmt.Fprintln(os.Stderr, "No successful update yet")
+		return 1
+	}
+	age := time.Since(health.LastSuccess).Round(time.Second)
+	if age > maxAge {
+		fmt.Fprintf(os.Stderr, "Last successful update was %v ago, last update at %s\n", age,
+			health.LastRun.Format(dateTimeFormat))
+		return 1
+	}
+	fmt.Printf("Last successful update was %v ago\n", age)
+	return 0
+}
+
+func readHealth() (Health, error) {
+	var health Health
+	if file := os.Getenv("GD_STATE_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return health, err
+		}
+		var s State
+		if err := json.Unmarshal(data, &s); err != nil {
+			return health, err
+		}
+		return s.Health, nil
+	}
+	addr := os.Getenv("GD_CONTROL_ADDR")
+	if addr == "" {
+		return health, errors.New("GD_STATE_FILE or GD_CONTROL_ADDR must be set")
+	}
+	res, err := httpClient.Get("http://" + addr + "/health")
+	if err != nil {
+		return health, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return health, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return health, fmt.Errorf("updater sent status code %d", res.StatusCode)
+	}
+	err = json.Unmarshal(body, &health)
+	return health, err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	hostsBlockBegin = "# BEGIN go-ddns"
+	hostsBlockEnd   = "# END go-ddns"
+)
+
+// InternalConfig is the value a record has inside the LAN, published to GD_HOSTS_FILE
+type InternalConfig struct {
+	//Value is published as is
+	Value string `json:"value,omitempty"`
+	//Interface publishes the first IPv4 address of this network interface
+	Interface string `json:"interface,omitempty"`
+}
+
+func (ic *InternalConfig) validate() error {
+	if (ic.Value == "") == (ic.Interface == "") {
+		return errors.New("internal needs exactly one of value or interface")
+	}
+	if ic.Value != "" && net.ParseIP(ic.Value) == nil {
+		return fmt.Errorf("invalid internal value %s", ic.Value)
+	}
+	return nil
+}
+
+// internalValue returns the value the record has inside the LAN
+func (ic *InternalConfig) internalValue() (string, error) {
+	if ic.Value != "" {
+		return ic.Value, nil
+	}
+	iface, err := net.InterfaceByName(ic.Interface)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+	}
+	return "", fmt.Errorf("interface %s has no IPv4 address", ic.Interface)
+}
+
+// updateHostsFile publishes the internal values of all records that have one to the go-ddns block in GD_HOSTS_FILE.
+// Records whose internal value can't be determined keep their previous entry.
+func updateHostsFile() error {
+	if hostsFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(hostsFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	before, previous, after := splitHostsFile(content)
+
+	entries := make(map[string]string)
+	for _, domain := range domains {
+		for _, name := range recordNames {
+			fqdn := recordFQDN(name, domain)
+			ic := recordConfig(fqdn).Internal
+			if ic == nil {
+				continue
+			}
+			value, err := ic.internalValue()
+			if err != nil {
+				log.Errorf("Failed to get internal value of %s, keeping the previous one: %v", fqdn, err)
+				value = previous[fqdn]
+			}
+			if value != "" {
+				entries[fqdn] = value
+			}
+		}
+	}
+
+	updated := joinHostsFile(before, entries, after)
+	if bytes.Equal(updated, content) {
+		return nil
+	}
+	//written in place instead of renamed, so bind mounted files like /etc/hosts in containers keep working
+	return os.WriteFile(hostsFile, updated, 0644)
+}
+
+// splitHostsFile splits the hosts file into the lines before and after the go-ddns block and the entries in it
+func splitHostsFile(content []byte) (before []string, entries map[string]string, after []string) {
+	entries = make(map[string]string)
+	inBlock, seenBlock := false, false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == hostsBlockBegin:
+			inBlock, seenBlock = true, true
+		case line == hostsBlockEnd:
+			inBlock = false
+		case inBlock:
+			if fields := strings.Fields(line); len(fields) == 2 {
+				entries[fields[1]] = fields[0]
+			}
+		case seenBlock:
+			after = append(after, line)
+		default:
+			before = append(before, line)
+		}
+	}
+	return before, entries, after
+}
+
+func joinHostsFile(before []string, entries map[string]string, after []string) []byte {
+	var buf bytes.Buffer
+	for _, line := range before {
+		buf.WriteString(line + "\n")
+	}
+	names := make([]string, 0, len(entries))
+	for fqdn := range entries {
+		names = append(names, fqdn)
+	}
+	sort.Strings(names)
+	buf.WriteString(hostsBlockBegin + "\n")
+	for _, fqdn := range names {
+		fmt.Fprintf(&buf, "%s %s\n", entries[fqdn], fqdn)
+	}
+	buf.WriteString(hostsBlockEnd + "\n")
+	for _, line := range after {
+		buf.WriteString(line + "\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHostsFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantEntries map[string]string
+		entries     map[string]string
+		want        string
+	}{
+		{
+			name:        "empty file",
+			content:     "",
+			wantEntries: map[string]string{},
+			entries:     map[string]string{"www.example.com": "192.168.1.10"},
+			want:        "# BEGIN go-ddns\n192.168.1.10 www.example.com\n# END go-ddns\n",
+		},
+		{
+			name:        "missing block",
+			content:     "127.0.0.1 localhost\n::1 localhost\n",
+			wantEntries: map[string]string{},
+			entries:     map[string]string{"www.example.com": "192.168.1.10"},
+			want:        "127.0.0.1 localhost\n::1 localhost\n# BEGIN go-ddns\n192.168.1.10 www.example.com\n# END go-ddns\n",
+		},
+		{
+			name:        "no trailing newline",
+			content:     "127.0.0.1 localhost\n# BEGIN go-ddns\n192.168.1.10 www.example.com\n# END go-ddns\n10.0.0.1 nas",
+			wantEntries: map[string]string{"www.example.com": "192.168.1.10"},
+			entries:     map[string]string{"www.example.com": "192.168.1.11"},
+			want:        "127.0.0.1 localhost\n# BEGIN go-ddns\n192.168.1.11 www.example.com\n# END go-ddns\n10.0.0.1 nas\n",
+		},
+		{
+			name: "lines before and after the block",
+			content: "# static entries\n127.0.0.1 localhost\n\n# BEGIN go-ddns\n192.168.1.10 www.example.com\n" +
+				"192.168.1.20 api.example.com\n# END go-ddns\n\n# managed by hand\n10.0.0.1 nas\n",
+			wantEntries: map[string]string{"www.example.com": "192.168.1.10", "api.example.com": "192.168.1.20"},
+			entries:     map[string]string{"www.example.com": "192.168.1.10", "mail.example.com": "192.168.1.30"},
+			want: "# static entries\n127.0.0.1 localhost\n\n# BEGIN go-ddns\n192.168.1.30 mail.example.com\n" +
+				"192.168.1.10 www.example.com\n# END go-ddns\n\n# managed by hand\n10.0.0.1 nas\n",
+		},
+		{
+			name:        "no entries left",
+			content:     "127.0.0.1 localhost\n# BEGIN go-ddns\n192.168.1.10 www.example.com\n# END go-ddns\n",
+			wantEntries: map[string]string{"www.example.com": "192.168.1.10"},
+			entries:     map[string]string{},
+			want:        "127.0.0.1 localhost\n# BEGIN go-ddns\n# END go-ddns\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, entries, after := splitHostsFile([]byte(tt.content))
+			if !reflect.DeepEqual(entries, tt.wantEntries) {
+				t.Errorf("splitHostsFile() entries = %v, want %v", entries, tt.wantEntries)
+			}
+			got := string(joinHostsFile(before, tt.entries, after))
+			if got != tt.want {
+				t.Errorf("joinHostsFile() = %q, want %q", got, tt.want)
+			}
+			//writing the same entries again doesn't change the file, so it isn't rewritten on every update
+			before, _, after = splitHostsFile([]byte(got))
+			if again := string(joinHostsFile(before, tt.entries, after)); again != got {
+				t.Errorf("second round trip = %q, want %q", again, got)
+			}
+		})
+	}
+}
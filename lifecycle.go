@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// lifecycle actions for records whose host went away
+const (
+	//lifecyclePark points the record to ParkIP
+	lifecyclePark = "park"
+	//lifecycleDelete deletes the record
+	lifecycleDelete = "delete"
+	//lifecycleLowerTTL keeps the value, but lowers the TTL so caches drop it soon once it is changed
+	lifecycleLowerTTL = "lowerTTL"
+)
+
+// LifecycleConfig decides what happens to a record on a graceful shutdown or when its source has been failing for a
+// while, e.g. so ephemeral machines don't leave records pointing to addresses that get reassigned to strangers
+type LifecycleConfig struct {
+	//Action is one of park, delete or lowerTTL
+	Action string `json:"action"`
+	//ParkIP is the address published by the park action
+	ParkIP string `json:"parkIP,omitempty"`
+	//TTL is the TTL written by the lowerTTL action
+	TTL uint64 `json:"ttl,omitempty"`
+	//OnShutdown applies the action when go-ddns is shut down gracefully
+	OnShutdown bool `json:"onShutdown,omitempty"`
+	//OfflineAfter applies the action once the source of the record has been failing for this long, e.g. 1h
+	OfflineAfter string `json:"offlineAfter,omitempty"`
+
+	offlineAfter time.Duration
+}
+
+func (lc *LifecycleConfig) validate() error {
+	switch lc.Action {
+	case lifecyclePark:
+		if net.ParseIP(lc.ParkIP) == nil {
+			return fmt.Errorf("park action needs a valid parkIP, got %q", lc.ParkIP)
+		}
+	case lifecycleDelete:
+	case lifecycleLowerTTL:
+		if lc.TTL == 0 {
+			return fmt.Errorf("lowerTTL action needs a ttl")
+		}
+		if lc.TTL < minTTL {
+			return fmt.Errorf("lowerTTL ttl %d is too low, godaddy does not accept TTLs below %d seconds", lc.TTL, minTTL)
+		}
+	default:
+		return fmt.Errorf("unknown lifecycle action %q, must be one of park, delete or lowerTTL", lc.Action)
+	}
+	if lc.OfflineAfter != "" {
+		var err error
+		if lc.offlineAfter, err = time.ParseDuration(lc.OfflineAfter); err != nil {
+			return fmt.Errorf("invalid offlineAfter: %v", err)
+		}
+	}
+	if !lc.OnShutdown && lc.offlineAfter == 0 {
+		return fmt.Errorf("lifecycle action needs onShutdown or offlineAfter")
+	}
+	return nil
+}
+
+// due reports whether the action has to be applied to the record in this update
+func (lc *LifecycleConfig) due(mode updateMode, rs *RecordState) bool {
+	if lc == nil {
+		return false
+	}
+	if mode == updateShutdown {
+		return lc.OnShutdown
+	}
+	return lc.offlineAfter > 0 && !rs.FailingSince.IsZero() && time.Since(rs.FailingSince) >= lc.offlineAfter
+}
+
+// apply returns the values and TTL the record gets from the action, the value that counts as written by us afterwards
+// and whether the record already looks like that
+func (lc *LifecycleConfig) apply(values []string, ttl uint64, rs *RecordState) (desired []string, newTTL uint64, written string, upToDate bool) {
+	switch lc.Action {
+	case lifecyclePark:
+		return []string{lc.ParkIP}, ttl, lc.ParkIP, sameValues(values, []string{lc.ParkIP})
+	case lifecycleDelete:
+		return nil, ttl, "", len(values) == 0
+	default:
+		return values, lc.TTL, rs.Value, len(values) == 0 || ttl <= lc.TTL
+	}
+}
+
+// hasShutdownActions reports whether any updated record has to be changed on shutdown
+func hasShutdownActions() bool {
+	for _, domain := range domains {
+		for _, name := range recordNames {
+			rc := recordConfig(recordFQDN(name, domain))
+			if rc.Shared || (rc.Lifecycle != nil && rc.Lifecycle.OnShutdown) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	log "github.com/sirupsen/logrus"
@@ -10,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -20,7 +22,40 @@ var (
 	updateInterval time.Duration
 	apiKey         string
 	apiSecret      string
+	credentialName string
 	domains        []string
+	recordNames    []string
+	notifyURL      string
+	ipSources      []string
+	shutdownGrace  time.Duration
+	forceInterval  time.Duration
+	stateFile      string
+	driftPolicy    string
+	ownershipMode  string
+	ownerID        string
+	allowTakeover  bool
+	hostsFile      string
+	natCheck       string
+	natGateway     string
+	verify         bool
+	verifyResolver *dnsResolver
+	//lookupResolver is GD_DNS_RESOLVER, nil for the system resolver
+	lookupResolver *dnsResolver
+	asnGuard       string
+	asnAllowed     map[uint32]bool
+	summaryFile    string
+	ttlMin         uint64
+	ttlMax         uint64
+	ttlStableAfter time.Duration
+
+	reachabilityPort   string
+	reachabilityHelper string
+
+	controlAddr  string
+	controlToken string
+	controlURL   string
+
+	forceFirstUpdate bool
 
 	zeroDialer net.Dialer
 	httpClient = &http.Client{
@@ -30,13 +65,32 @@ var (
 
 const dateTimeFormat = "2006-01-02 15:04"
 
-// command line flags
+// defaultTTL is the TTL in seconds written to records unless GD_TTL_MIN and GD_TTL_MAX say otherwise
+const defaultTTL = 600
+
+// minTTL is the lowest TTL in seconds godaddy accepts
+const minTTL = 600
+
+// defaultInterval is used without GD_INTERVAL
+const defaultInterval = 600 * time.Second
+
+// verbose is set by the -v flag
+var verbose bool
+
+// command line flags, parsed in main so tests can register their own
 func init() {
-	verbose := flag.Bool("v", false, "Turns on verbose output")
-	flag.Parse()
-	if *verbose {
-		log.SetLevel(log.TraceLevel)
-		log.Trace("Set log level to trace")
+	flag.BoolVar(&verbose, "v", false, "Turns on verbose output")
+	flag.BoolVar(&forceFirstUpdate, "force", false, "Rewrites all records on the first update, even if they are up to date")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\nCommands:\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "  init\tset up credentials, domains and records interactively and write the configuration")
+		fmt.Fprintln(flag.CommandLine.Output(), "  doctor\tcheck configuration, IP sources and godaddy access and exit")
+		fmt.Fprintln(flag.CommandLine.Output(), "  approvals\tlist, approve or reject changes waiting for approval in the running updater")
+		fmt.Fprintln(flag.CommandLine.Output(), "  auth\tadd, list or remove credentials in the encrypted credential store")
+		fmt.Fprintln(flag.CommandLine.Output(), "  resync\tforget the saved record values, re-read and rewrite all records once and exit")
+		fmt.Fprintln(flag.CommandLine.Output(), "  healthcheck\texit non-zero if the running updater had no successful update for too long")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nWithout a command the updater is started.\n\nFlags:")
+		flag.PrintDefaults()
 	}
 }
 
@@ -49,115 +103,554 @@ func init() {
 	httpClient.Transport = transport
 }
 
-// get environment vars
-func init() {
-	interval := os.Getenv("GD_INTERVAL")
-	var err error
-	updateInterval, err = time.ParseDuration(interval)
-	if err != nil {
-		log.Warn("No update interval given, defaulting to 600 seconds.")
-		updateInterval = time.Second * 600
-	}
-
-	apiKey = os.Getenv("GD_API_KEY")
-	if apiKey == "" {
-		log.Fatalf("No API Key provided in environment (GD_API_KEY).")
-	}
-	apiSecret = os.Getenv("GD_API_SECRET")
-	if apiSecret == "" {
-		log.Fatalf("No API Secret provided in environment (GD_API_SECRET).")
+func main() {
+	flag.Parse()
+	if verbose {
+		log.SetLevel(log.TraceLevel)
+		log.Trace("Set log level to trace")
 	}
-	domains = strings.Split(os.Getenv("GD_DOMAINS"), ",")
-	if len(domains) < 1 {
-		log.Fatalf("No domains provided in environment (GD_DOMAINS).")
+	switch flag.Arg(0) {
+	case "":
+		runDaemon()
+	case "doctor":
+		os.Exit(runDoctor())
+	case "resync":
+		os.Exit(runResync())
+	case "healthcheck":
+		os.Exit(runHealthcheck())
+	case "init":
+		os.Exit(runInit())
+	case "auth":
+		os.Exit(runAuth(flag.Args()[1:]))
+	case "approvals":
+		os.Exit(runApprovals(flag.Args()[1:]))
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
 }
 
-func main() {
+// runDaemon runs the updater until it receives a shutdown signal
+func runDaemon() {
+	if err := loadConfig(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := loadState(); err != nil {
+		log.Fatalf("Failed to load state from %s: %v", stateFile, err)
+	}
 	log.Info("Starting go-ddns updater...")
-	//establish cancelable context and waitgroup to wait for cancellation
-	ctx, cancel := context.WithCancel(context.Background())
+	//stopCtx stops the loop from starting new updates, abortCtx aborts updates that are still in flight
+	stopCtx, stop := context.WithCancel(context.Background())
+	abortCtx, abort := context.WithCancel(context.Background())
+	defer abort()
 	var wg sync.WaitGroup
-	go runUpdateLoop(ctx, &wg)
+	wg.Add(1)
+	//SIGHUP triggers a resync of all records
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	//decisions on pending changes made through the control API trigger an update
+	trigger := make(chan struct{}, 1)
+	if controlAddr != "" {
+		if err := startControlServer(stopCtx, trigger); err != nil {
+			log.Fatalf("Failed to start control server on %s: %v", controlAddr, err)
+		}
+	}
+	go runUpdateLoop(stopCtx, abortCtx, &wg, hup, trigger)
 
 	//get signal channel and wait for signal
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, os.Kill, os.Interrupt)
 	<-sigs
-	log.Info("Received shutdown signal...")
+	log.Infof("Received shutdown signal, waiting up to %v for running updates to finish...", shutdownGrace)
 
-	//cancel context and wait for full propagation
-	cancel()
-	wg.Wait()
+	//stop the loop and give running updates the grace period to finish, a second signal exits immediately
+	stop()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownGrace):
+		log.Warn("Shutdown grace period expired, aborting running updates")
+		abort()
+		<-done
+	case <-sigs:
+		log.Warn("Received second shutdown signal, exiting immediately")
+		os.Exit(1)
+	}
 	log.Info("Goodbye :(")
 }
 
-func runUpdateLoop(ctx context.Context, wg *sync.WaitGroup) {
-	wg.Add(1)
+// runResync forgets the saved state and rewrites all records from scratch once.
+// It returns the exit code for the resync command.
+func runResync() int {
+	if err := loadConfig(); err != nil {
+		log.Errorf("Invalid configuration: %v", err)
+		return 1
+	}
+	if err := loadState(); err != nil {
+		log.Errorf("Failed to load state from %s: %v", stateFile, err)
+		return 1
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	//the saved state is ignored on purpose, everything is read from godaddy again
+	state.forget()
+	if !updateAll(ctx, ctx, updateForce) {
+		return 1
+	}
+	return 0
+}
+
+// runUpdateLoop updates all domains every updateInterval until stopCtx is canceled, resyncing whenever
+// a value is received on resync and updating right away whenever a value is received on trigger.
+// Updates that already started when stopCtx is canceled run to completion unless abortCtx is canceled as well.
+func runUpdateLoop(stopCtx, abortCtx context.Context, wg *sync.WaitGroup, resync <-chan os.Signal, trigger <-chan struct{}) {
 	defer wg.Done()
 
-	loopFunc := func() {
-		currIPAddr, err := getPublicIPAddress()
-		if err != nil {
-			log.Errorf("failed to get public IP address: %v", err)
-			return
-		}
-		for _, domain := range domains {
-			err := checkAndUpdate(ctx, domain, currIPAddr)
-			if err != nil {
-				log.Errorf("Failed to update DNS records: %v", err)
-			} else {
-				log.Infof("Update successful at %v", time.Now().Format(dateTimeFormat))
-			}
-		}
+	loopFunc := func(mode updateMode) {
+		updateAll(stopCtx, abortCtx, mode)
 		log.Infof("Next update at %v", time.Now().Add(updateInterval).Format(dateTimeFormat))
 	}
 
 	//run once before the loop
-	loopFunc()
+	if forceFirstUpdate {
+		loopFunc(updateForce)
+	} else {
+		loopFunc(updateNormal)
+	}
 	for {
 		select {
 		case <-time.After(updateInterval):
-			loopFunc()
-		case <-ctx.Done():
+			loopFunc(updateNormal)
+		case <-resync:
+			log.Info("Received SIGHUP, resyncing all records")
+			state.forget()
+			loopFunc(updateForce)
+		case <-trigger:
+			loopFunc(updateNormal)
+		case <-stopCtx.Done():
 			log.Trace("Stopping update loop")
+			if hasShutdownActions() {
+				log.Info("Applying shutdown actions to records")
+				updateAll(abortCtx, abortCtx, updateShutdown)
+			}
 			return
 		}
 	}
 }
 
-// checkAndUpdate determines if it is necessary to update the DNS records and does so accordingly
-func checkAndUpdate(ctx context.Context, domain string, currentIpAddr string) error {
-	//get current address from godaddy
-	godaddyIPAddr, err := getDomainAtRecordIP(ctx, domain)
+// updateMode changes how updateAll treats the records
+type updateMode int
+
+const (
+	updateNormal updateMode = iota
+	//updateForce rewrites every record, even if it already has the correct value
+	updateForce
+	//updateShutdown withdraws our values from shared records and applies the lifecycle actions of records that
+	//have to be changed on shutdown, all other records are left alone
+	updateShutdown
+)
+
+// updateAll updates the records of all domains once and reports whether every domain was updated successfully
+func updateAll(stopCtx, abortCtx context.Context, mode updateMode) bool {
+	sources := newSourceResolver(abortCtx, mode == updateShutdown)
+	summary := newRunSummary()
+	ok := true
+	for _, domain := range domains {
+		if stopCtx.Err() != nil {
+			//records of earlier domains were already written, so the state below still has to be saved
+			log.Info("Shutting down, skipping remaining domains")
+			ok = false
+			break
+		}
+		for _, name := range recordNames {
+			summary.check(recordFQDN(name, domain))
+		}
+		err := checkAndUpdate(abortCtx, domain, sources, mode, summary)
+		if err != nil {
+			ok = false
+			for _, name := range recordNames {
+				summary.failed(recordFQDN(name, domain))
+			}
+			switch errorKind(err) {
+			case ErrorKindAuth:
+				log.Errorf("Failed to update DNS records of %s, godaddy rejected the API credentials: %v", domain, err)
+			case ErrorKindTransient, ErrorKindRateLimited:
+				log.Warnf("Failed to update DNS records of %s, retrying with next update: %v", domain, err)
+			default:
+				log.Errorf("Failed to update DNS records of %s: %v", domain, err)
+			}
+		}
+		notifyUpdateError(abortCtx, domain, err)
+		if err == nil && mode != updateShutdown {
+			if err := updatePTRRecords(abortCtx, domain, summary); err != nil {
+				ok = false
+				log.Errorf("%v", err)
+				notify(abortCtx, "ptr", domain, err.Error())
+			}
+			if verify {
+				if err := verifyRecords(abortCtx, domain, summary); err != nil {
+					ok = false
+					log.Errorf("%v", err)
+				}
+			}
+		}
+	}
+	if mode != updateShutdown {
+		if err := updateHostsFile(); err != nil {
+			ok = false
+			log.Errorf("Failed to update internal records in %s: %v", hostsFile, err)
+		}
+	}
+	ok = ok && !sources.failed
+	recordRun(ok)
+	summary.finish()
+	if err := saveState(); err != nil {
+		log.Errorf("failed to save state to %s: %v", stateFile, err)
+	}
+	return ok
+}
+
+// checkAndUpdate determines which records of the domain need to be updated and does so accordingly,
+// using a single call per record type for the whole zone if more than one record changed
+func checkAndUpdate(ctx context.Context, domain string, sources *sourceResolver, mode updateMode, summary *runSummary) error {
+	//get the current records of the zone from godaddy, once for every type we manage
+	zoneRecords := make(map[string][]GodaddyDNSRecord)
+	for _, name := range recordNames {
+		recordType := recordConfig(recordFQDN(name, domain)).recordType()
+		if _, ok := zoneRecords[recordType]; ok {
+			continue
+		}
+		records, err := getDomainRecords(ctx, domain, recordType)
+		if err != nil {
+			return fmt.Errorf("failed to get %s records for domain %s: %w", recordType, domain, err)
+		}
+		zoneRecords[recordType] = records
+	}
+	ownership, err := loadZoneOwnership(ctx, domain)
 	if err != nil {
-		return fmt.Errorf("failed to get DNS record IP address for domain %s: %v", domain, err)
+		return err
 	}
-	if currentIpAddr == godaddyIPAddr {
-		log.Infof("No update necessary for %s", domain)
+	updates := make(map[string][]GodaddyDNSRecord)
+	deleted := make(map[string][]string)
+	//ours is the value this instance published in every updated record
+	ours := make(map[string]string)
+	var claims []string
+	for _, name := range recordNames {
+		fqdn := recordFQDN(name, domain)
+		if err := checkPolicy(fqdn); err != nil {
+			log.Errorf("Not updating %s: %v", fqdn, err)
+			notify(ctx, "policy-violation", domain, err.Error())
+			summary.failed(fqdn)
+			continue
+		}
+		rc := recordConfig(fqdn)
+		recordType := rc.recordType()
+		values := recordValues(zoneRecords[recordType], name)
+		ttl := recordTTL(zoneRecords[recordType], name)
+		rs := state.record(fqdn)
+		value, publish, err := recordValue(sources, rc, fqdn)
+		if err != nil && !errors.Is(err, errShuttingDown) {
+			summary.failed(fqdn)
+			if rs.FailingSince.IsZero() {
+				rs.FailingSince = time.Now()
+			}
+		} else if publish {
+			rs.FailingSince = time.Time{}
+		}
+
+		var desired []string
+		var upToDate bool
+		//written is the value of this instance in the record after the update
+		written := value
+		owned := true
+		if rc.Shared {
+			//shared records are never clobbered, we only add our own value and remove the one we wrote before
+			desired = sharedValues(values, rs.Value, value)
+			ttl = adaptiveTTL(rs, value)
+			upToDate = sameValues(desired, values) && (!adaptiveTTLEnabled() || recordTTL(zoneRecords[recordType], name) == ttl)
+			if upToDate && !publish {
+				continue
+			}
+			if !publish {
+				log.Warnf("Withdrawing %s from shared record %s", rs.Value, fqdn)
+			}
+		} else if !publish {
+			if !rc.Lifecycle.due(mode, rs) {
+				continue
+			}
+			//never park or delete what someone else wrote
+			if !ownership.owns(name) || (len(values) > 0 && !sameValues(values, []string{rs.Value})) {
+				log.Warnf("Not applying %s to %s, it was not written by go-ddns", rc.Lifecycle.Action, fqdn)
+				summary.skipped(fqdn)
+				continue
+			}
+			desired, ttl, written, upToDate = rc.Lifecycle.apply(values, ttl, rs)
+			if !upToDate {
+				log.Warnf("Applying %s to %s", rc.Lifecycle.Action, fqdn)
+				notify(ctx, "lifecycle", domain, fmt.Sprintf("applying %s to %s", rc.Lifecycle.Action, fqdn))
+			}
+		} else {
+			owned = ownership.owns(name)
+			if !owned && len(values) > 0 && !allowTakeover {
+				log.Warnf("Not updating %s, it is not owned by go-ddns (set GD_ALLOW_TAKEOVER=true to take it over)", fqdn)
+				summary.skipped(fqdn)
+				continue
+			}
+			if handleDrift(ctx, domain, fqdn, values, value) {
+				summary.skipped(fqdn)
+				continue
+			}
+			desired = []string{value}
+			ttl = adaptiveTTL(rs, value)
+			upToDate = sameValues(values, desired) && (!adaptiveTTLEnabled() || recordTTL(zoneRecords[recordType], name) == ttl)
+		}
+		if upToDate && mode != updateForce && !refreshDue(fqdn) {
+			log.Infof("No update necessary for %s", fqdn)
+			continue
+		}
+		if frozen(rc, time.Now()) {
+			log.Infof("Deferring update of %s, it is inside a freeze window", fqdn)
+			summary.skipped(fqdn)
+			continue
+		}
+		var jump string
+		if publish && !upToDate {
+			jump = asnJump(rc, rs.Value, value)
+		}
+		if jump != "" && asnGuard == asnGuardWarn {
+			log.Warnf("Publishing %s in %s although it jumped to another network: %s", value, fqdn, jump)
+			notify(ctx, "asn-jump", domain, fmt.Sprintf("%s: %s", fqdn, jump))
+		}
+		if (rc.Approval || (jump != "" && asnGuard == asnGuardBlock)) && !upToDate &&
+			!awaitApproval(ctx, domain, fqdn, strings.Join(values, ","), strings.Join(desired, ","), jump) {
+			summary.skipped(fqdn)
+			continue
+		}
+		log.Debugf("%s: old values: %v; new values: %v", fqdn, values, desired)
+		if len(desired) == 0 {
+			deleted[recordType] = append(deleted[recordType], name)
+		}
+		if ttl == 0 {
+			ttl = defaultTTL
+		}
+		for _, d := range desired {
+			updates[recordType] = append(updates[recordType], GodaddyDNSRecord{
+				Data: d,
+				Name: name,
+				TTL:  ttl,
+			})
+		}
+		ours[fqdn] = written
+		if !owned {
+			claims = append(claims, name)
+		}
+	}
+	if len(ours) == 0 {
 		return nil
 	}
-	log.Debugf("oldIP: %s; newIP: %s", godaddyIPAddr, currentIpAddr)
 
-	err = setDomainAtRecord(ctx, domain, currentIpAddr)
-	if err != nil {
+	if err := ownership.claim(ctx, claims); err != nil {
 		return err
 	}
+	for recordType, records := range zoneRecords {
+		if err := updateZoneRecords(ctx, domain, recordType, records, updates[recordType], deleted[recordType]); err != nil {
+			return err
+		}
+	}
+	for fqdn, value := range ours {
+		rs := state.record(fqdn)
+		trackChange(rs, fqdn, value)
+		approvalWritten(fqdn)
+		summary.updated(fqdn)
+		rs.Value = value
+		rs.WrittenAt = time.Now()
+		rs.AdoptedFor = ""
+	}
+	return nil
+}
 
+// recordValue returns the value this instance publishes in the record and false if it shouldn't publish any.
+// The error is only set if the source of the record failed.
+func recordValue(sources *sourceResolver, rc *RecordConfig, fqdn string) (string, bool, error) {
+	//a static record doesn't depend on the detected IP unless onlyIn needs it
+	if rc.Static != "" && len(rc.OnlyIn) == 0 {
+		return rc.Static, true, nil
+	}
+	detected, err := sources.address(rc.Source, rc.recordType())
+	if err != nil {
+		log.Debugf("Not publishing %s, source %s failed: %v", fqdn, describeSource(rc.Source), err)
+		return "", false, err
+	}
+	value, publish, err := rc.publishedValue(detected)
+	if err != nil {
+		log.Errorf("Not publishing %s: %v", fqdn, err)
+		return "", false, nil
+	}
+	if !publish {
+		log.Infof("Not publishing %s, %s is outside of its allowed ranges", fqdn, detected)
+		return "", false, nil
+	}
+	return value, true, nil
+}
+
+// updateZoneRecords writes the records in updates and deletes all records named in deleted, replacing all records of
+// the given type with the same names. A single name is replaced or deleted on its own, several names are replaced in a
+// single call for the whole zone, keeping the other zoneRecords untouched, unless the zone has shared records.
+// Nothing is written if the write policy forbids any of the names.
+func updateZoneRecords(ctx context.Context, domain, recordType string, zoneRecords, updates []GodaddyDNSRecord, deleted []string) error {
+	names := make(map[string]bool)
+	for _, update := range updates {
+		names[update.Name] = true
+	}
+	for _, name := range deleted {
+		names[name] = true
+	}
+	for name := range names {
+		//ownership markers are allowed together with the record they mark
+		if marked, ok := markedRecordName(name); ok && recordType == "TXT" {
+			name = marked
+		}
+		if err := checkPolicy(recordFQDN(name, domain)); err != nil {
+			return err
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	//other instances change shared records at any time, writing the whole type would revert them to our snapshot
+	if len(names) > 1 && !hasSharedRecords(domain, recordType) {
+		return setDomainRecords(ctx, domain, recordType, replaceRecords(zoneRecords, names, updates))
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		var values []GodaddyDNSRecord
+		for _, update := range updates {
+			if update.Name == name {
+				values = append(values, GodaddyDNSRecord{
+					Data: update.Data,
+					TTL:  update.TTL,
+				})
+			}
+		}
+		var err error
+		if len(values) == 0 {
+			err = deleteDomainRecord(ctx, domain, recordType, name)
+		} else {
+			err = setDomainRecord(ctx, domain, recordType, name, values)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// getPublicIPAddress gets the current public IP address of this device
-func getPublicIPAddress() (string, error) {
-	resp, err := httpClient.Get("http://ifconfig.co")
+// hasSharedRecords reports whether any of the records of the given type we manage in the zone of domain is shared
+func hasSharedRecords(domain, recordType string) bool {
+	for _, name := range recordNames {
+		if rc := recordConfig(recordFQDN(name, domain)); rc.Shared && rc.recordType() == recordType {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshDue reports whether the record has not been written for longer than GD_FORCE_INTERVAL
+func refreshDue(fqdn string) bool {
+	if forceInterval == 0 {
+		return false
+	}
+	return time.Since(state.record(fqdn).WrittenAt) >= forceInterval
+}
+
+// recordValues returns the values of all records with the given name
+func recordValues(zoneRecords []GodaddyDNSRecord, name string) []string {
+	var values []string
+	for _, record := range zoneRecords {
+		if record.Name == name {
+			values = append(values, record.Data)
+		}
+	}
+	return values
+}
+
+// replaceRecords returns a copy of zoneRecords in which all records named in names are replaced by updates,
+// leaving records we don't manage untouched
+func replaceRecords(zoneRecords []GodaddyDNSRecord, names map[string]bool, updates []GodaddyDNSRecord) []GodaddyDNSRecord {
+	var res []GodaddyDNSRecord
+	for _, record := range zoneRecords {
+		if !names[record.Name] {
+			res = append(res, record)
+		}
+	}
+	return append(res, updates...)
+}
+
+// recordTTL returns the TTL of the records with the given name, or 0 if there are none
+func recordTTL(zoneRecords []GodaddyDNSRecord, name string) uint64 {
+	for _, record := range zoneRecords {
+		if record.Name == name {
+			return record.TTL
+		}
+	}
+	return 0
+}
+
+// recordFQDN returns the fully qualified name of the record name in domain
+func recordFQDN(name, domain string) string {
+	if name == "@" {
+		return domain
+	}
+	return name + "." + domain
+}
+
+// getPublicIPAddress gets the current public IP address of this device from the first IP source that answers
+func getPublicIPAddress(ctx context.Context) (string, error) {
+	var err error
+	for _, source := range ipSources {
+		var ip string
+		ip, err = getIPAddressFromSource(ctx, source)
+		if err == nil {
+			return ip, nil
+		}
+		log.Debugf("IP source %s failed: %v", source, err)
+	}
+	return "", err
+}
+
+// getIPAddressFromSource gets the public IP address of this device from an URL that responds with just the address
+// or from a DNS-based source
+func getIPAddressFromSource(ctx context.Context, source string) (string, error) {
+	if strings.HasPrefix(source, "dns:") {
+		return getIPAddressFromDNS(ctx, source)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
 	if err != nil {
 		return "", err
 	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", err
 	}
-	ip := string(body)
-	ip = strings.TrimRight(ip, "\n")
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s sent non-ok status code %d", source, resp.StatusCode)
+	}
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("%s did not respond with an IP address", source)
+	}
 	return ip, nil
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateAllSavesStateOnShutdown(t *testing.T) {
+	defer func(d, r []string, file string, s *State) {
+		domains, recordNames, stateFile, state = d, r, file, s
+	}(domains, recordNames, stateFile, state)
+	domains = []string{"example.com", "example.org"}
+	recordNames = []string{"@"}
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	state = newState()
+	//written by this run before the shutdown started
+	state.record("example.com").Value = "192.0.2.1"
+	state.record("example.com").Owned = true
+
+	stopCtx, stop := context.WithCancel(context.Background())
+	stop()
+	if updateAll(stopCtx, context.Background(), updateNormal) {
+		t.Error("updateAll() reported success although it skipped domains")
+	}
+
+	if err := loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if rs := state.record("example.com"); rs.Value != "192.0.2.1" || !rs.Owned {
+		t.Errorf("saved record = %+v, want the value and ownership written before the shutdown", rs)
+	}
+	if state.Health.LastRun.IsZero() || !state.Health.LastSuccess.IsZero() {
+		t.Errorf("saved health = %+v, want a failed run", state.Health)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// NAT check modes, set through GD_NAT_CHECK
+const (
+	natCheckOff   = "off"
+	natCheckWarn  = "warn"
+	natCheckBlock = "block"
+)
+
+// natTimeout bounds every single router query, routers that don't speak NAT-PMP or UPnP simply never answer
+const natTimeout = 3 * time.Second
+
+// cgnatPrefix is the shared address space of RFC 6598 used for carrier-grade NAT
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// lastNATProblems keeps the problems of the last check, so every new problem is only notified once
+var lastNATProblems string
+
+// checkNAT compares the detected IP with the external address of the router and the addresses of the local interfaces
+// to detect carrier-grade NAT or double NAT, in which case the detected IP doesn't reach us.
+// It reports whether the records may be updated with the detected IP.
+func checkNAT(ctx context.Context, detected string) bool {
+	if natCheck == natCheckOff {
+		return true
+	}
+	problems := natProblems(ctx, detected)
+	if len(problems) == 0 {
+		lastNATProblems = ""
+		return true
+	}
+	msg := fmt.Sprintf("%s is probably not reachable from the internet: %s", detected, strings.Join(problems, "; "))
+	if natCheck == natCheckBlock {
+		log.Errorf("%s, not updating any records", msg)
+	} else {
+		log.Warn(msg)
+	}
+	if msg != lastNATProblems {
+		lastNATProblems = msg
+		notify(ctx, "nat", "", msg)
+	}
+	return natCheck != natCheckBlock
+}
+
+// natProblems returns a description of everything that hints at CGNAT or double NAT
+func natProblems(ctx context.Context, detected string) []string {
+	var problems []string
+	detectedAddr, err := netip.ParseAddr(detected)
+	if err != nil {
+		return []string{fmt.Sprintf("detected IP %s is invalid", detected)}
+	}
+	if cgnatPrefix.Contains(detectedAddr) {
+		problems = append(problems, fmt.Sprintf("detected IP %s is in the CGNAT range %s", detected, cgnatPrefix))
+	}
+
+	router, err := routerExternalAddress(ctx)
+	if err != nil {
+		log.Debugf("Failed to get external address from router: %v", err)
+	} else {
+		switch {
+		case cgnatPrefix.Contains(router):
+			problems = append(problems, fmt.Sprintf("router WAN address %s is in the CGNAT range %s", router, cgnatPrefix))
+		case router.IsPrivate():
+			problems = append(problems, fmt.Sprintf("router WAN address %s is private, there is another NAT in front of it", router))
+		case router != detectedAddr:
+			problems = append(problems, fmt.Sprintf("router WAN address %s differs from the detected IP", router))
+		}
+	}
+
+	//hosts directly connected to the WAN, e.g. the router itself, see their address on an interface
+	for _, addr := range interfaceAddresses() {
+		if cgnatPrefix.Contains(addr) {
+			problems = append(problems, fmt.Sprintf("interface address %s is in the CGNAT range %s", addr, cgnatPrefix))
+		} else if isPublic(addr) && addr != detectedAddr {
+			problems = append(problems, fmt.Sprintf("interface address %s differs from the detected IP", addr))
+		}
+	}
+	return problems
+}
+
+func isPublic(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnatPrefix.Contains(addr)
+}
+
+// tunnelInterfaces are prefixes of VPN and overlay devices, their addresses never say anything about the WAN
+var tunnelInterfaces = []string{"tun", "wg", "tailscale"}
+
+// interfaceAddresses returns the IPv4 addresses of the interface that holds the default route, other interfaces
+// like docker bridges or VPNs have nothing to do with how we reach the internet
+func interfaceAddresses() []netip.Addr {
+	name, _, err := defaultRoute()
+	if err != nil {
+		log.Debugf("Failed to determine the default route interface: %v", err)
+		return nil
+	}
+	for _, prefix := range tunnelInterfaces {
+		if strings.HasPrefix(name, prefix) {
+			log.Debugf("Default route goes through tunnel %s, skipping interface addresses", name)
+			return nil
+		}
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		log.Debugf("Failed to get interface %s: %v", name, err)
+		return nil
+	}
+	if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+		return nil
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var res []netip.Addr
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			if a, ok := netip.AddrFromSlice(ipNet.IP.To4()); ok {
+				res = append(res, a)
+			}
+		}
+	}
+	return res
+}
+
+// routerExternalAddress asks the router for its WAN address, first using NAT-PMP and then UPnP IGD
+func routerExternalAddress(ctx context.Context) (netip.Addr, error) {
+	gateway, err := defaultGateway()
+	if err == nil {
+		addr, err := natPMPExternalAddress(ctx, gateway)
+		if err == nil {
+			return addr, nil
+		}
+		log.Debugf("NAT-PMP query to %s failed: %v", gateway, err)
+	} else {
+		log.Debugf("Failed to determine default gateway, skipping NAT-PMP: %v", err)
+	}
+	return upnpExternalAddress(ctx)
+}
+
+// defaultGateway returns GD_NAT_GATEWAY or the default gateway from the linux routing table
+func defaultGateway() (netip.Addr, error) {
+	if natGateway != "" {
+		return netip.ParseAddr(natGateway)
+	}
+	_, gateway, err := defaultRoute()
+	return gateway, err
+}
+
+// defaultRoute reads the interface and gateway of the default route from the linux routing table
+func defaultRoute() (string, netip.Addr, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", netip.Addr{}, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		//Iface Destination Gateway ..., addresses are hex encoded in host byte order
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], binary.LittleEndian.Uint32(raw))
+		return fields[0], netip.AddrFrom4(b), nil
+	}
+	return "", netip.Addr{}, errors.New("no default route found")
+}
+
+// natPMPExternalAddress asks the gateway for its external address using NAT-PMP (RFC 6886)
+func natPMPExternalAddress(ctx context.Context, gateway netip.Addr) (netip.Addr, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp4", netip.AddrPortFrom(gateway, 5351).String())
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(natTimeout))
+	//version 0, opcode 0 requests the external address
+	if _, err := conn.Write([]byte{0, 0}); err != nil {
+		return netip.Addr{}, err
+	}
+	res := make([]byte, 16)
+	n, err := conn.Read(res)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if n < 12 || res[0] != 0 || res[1] != 128 {
+		return netip.Addr{}, errors.New("invalid NAT-PMP response")
+	}
+	if code := binary.BigEndian.Uint16(res[2:4]); code != 0 {
+		return netip.Addr{}, fmt.Errorf("NAT-PMP result code %d", code)
+	}
+	return netip.AddrFrom4([4]byte{res[8], res[9], res[10], res[11]}), nil
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+// findWANService searches the device tree for the service that knows the external address
+func (d upnpDevice) findWANService() (upnpService, bool) {
+	for _, s := range d.Services {
+		if strings.Contains(s.ServiceType, ":WANIPConnection:") || strings.Contains(s.ServiceType, ":WANPPPConnection:") {
+			return s, true
+		}
+	}
+	for _, child := range d.Devices {
+		if s, ok := child.findWANService(); ok {
+			return s, true
+		}
+	}
+	return upnpService{}, false
+}
+
+// upnpExternalAddress discovers an internet gateway device via SSDP and asks it for its external address
+func upnpExternalAddress(ctx context.Context) (netip.Addr, error) {
+	location, err := ssdpDiscover()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, natTimeout)
+	defer cancel()
+
+	//get device description
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer res.Body.Close()
+	var desc struct {
+		Device upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&desc); err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to parse UPnP device description: %v", err)
+	}
+	service, ok := desc.Device.findWANService()
+	if !ok {
+		return netip.Addr{}, errors.New("UPnP device has no WAN connection service")
+	}
+	base, _ := url.Parse(location)
+	control, err := base.Parse(service.ControlURL)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	//call GetExternalIPAddress
+	body := fmt.Sprintf(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" `+
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`+
+		`<u:GetExternalIPAddress xmlns:u="%s"/></s:Body></s:Envelope>`, service.ServiceType)
+	req, err = http.NewRequestWithContext(ctx, "POST", control.String(), strings.NewReader(body))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#GetExternalIPAddress"`, service.ServiceType))
+	soapRes, err := httpClient.Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer soapRes.Body.Close()
+	if soapRes.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("UPnP GetExternalIPAddress returned status code %d", soapRes.StatusCode)
+	}
+	decoder := xml.NewDecoder(soapRes.Body)
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return netip.Addr{}, errors.New("UPnP response contains no external address")
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "NewExternalIPAddress" {
+			var ip string
+			if err := decoder.DecodeElement(&ip, &start); err != nil {
+				return netip.Addr{}, err
+			}
+			return netip.ParseAddr(strings.TrimSpace(ip))
+		}
+	}
+}
+
+// ssdpDiscover searches the LAN for an internet gateway device and returns the location of its description
+func ssdpDiscover() (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(natTimeout))
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	dst := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+	if _, err := conn.WriteTo([]byte(msg), dst); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 2048)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		return "", fmt.Errorf("no UPnP gateway answered: %v", err)
+	}
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+	if err != nil {
+		return "", err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	location := res.Header.Get("Location")
+	if location == "" {
+		return "", errors.New("UPnP gateway sent no location")
+	}
+	return location, nil
+}
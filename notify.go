@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// Notification is the JSON body posted to the notification webhook
+type Notification struct {
+	Event   string    `json:"event"`
+	Domain  string    `json:"domain,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// notify posts a notification to the webhook in GD_NOTIFY_URL, if configured.
+// Failing to notify is only logged, it should never stop an update.
+func notify(ctx context.Context, event, domain, message string) {
+	if notifyURL == "" {
+		return
+	}
+	payload, err := json.Marshal(Notification{
+		Event:   event,
+		Domain:  domain,
+		Message: message,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		log.Errorf("failed to encode notification: %v", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", notifyURL, bytes.NewReader(payload))
+	if err != nil {
+		log.Errorf("failed to create notification request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		log.Errorf("failed to send notification: %v", err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		log.Errorf("notification webhook sent non-ok status code %d", res.StatusCode)
+	}
+}
+
+// authFailed holds the domains whose credentials were rejected, so the rejection is only notified once until an
+// update of the domain succeeds again
+var authFailed = make(map[string]bool)
+
+// notifyUpdateError notifies about errors that need someone to look at the configuration, err is nil after a
+// successful update. Transient and rate limited errors are left to the next update and are only logged.
+func notifyUpdateError(ctx context.Context, domain string, err error) {
+	if err == nil {
+		delete(authFailed, domain)
+		return
+	}
+	switch kind := errorKind(err); kind {
+	case ErrorKindAuth:
+		if authFailed[domain] {
+			return
+		}
+		authFailed[domain] = true
+		notify(ctx, "auth-failed", domain, fmt.Sprintf("godaddy rejected the API credentials, check GD_API_KEY and GD_API_SECRET: %v", err))
+	case ErrorKindNotFound, ErrorKindValidation, ErrorKindUnknown:
+		notify(ctx, "update-failed", domain, err.Error())
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestNotifyAuthFailedOnce(t *testing.T) {
+	url := notifyURL
+	notifyURL = "https://hooks.example.com/goddns"
+	t.Cleanup(func() {
+		notifyURL = url
+		authFailed = make(map[string]bool)
+	})
+	fake := installFakeGodaddy(t, nil)
+	authErr := &GodaddyError{Kind: ErrorKindAuth, StatusCode: http.StatusUnauthorized}
+	notified := func() int {
+		n := 0
+		for _, r := range fake.requests {
+			if r == "POST /goddns" {
+				n++
+			}
+		}
+		return n
+	}
+
+	ctx := context.Background()
+	notifyUpdateError(ctx, "example.com", authErr)
+	notifyUpdateError(ctx, "example.com", authErr)
+	if n := notified(); n != 1 {
+		t.Fatalf("rejected credentials were notified %d times, want once", n)
+	}
+	notifyUpdateError(ctx, "example.org", authErr)
+	if n := notified(); n != 2 {
+		t.Fatalf("rejected credentials of another domain were notified %d times in total, want 2", n)
+	}
+	//a transient error doesn't mean the credentials work again
+	notifyUpdateError(ctx, "example.com", &GodaddyError{Kind: ErrorKindTransient})
+	notifyUpdateError(ctx, "example.com", authErr)
+	if n := notified(); n != 2 {
+		t.Fatalf("rejected credentials were notified again after a transient error")
+	}
+	notifyUpdateError(ctx, "example.com", nil)
+	notifyUpdateError(ctx, "example.com", authErr)
+	if n := notified(); n != 3 {
+		t.Errorf("rejected credentials were not notified again after a successful update")
+	}
+}
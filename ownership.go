@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ownership modes, set through GD_OWNERSHIP
+const (
+	//ownershipOff updates every configured record, this is the default
+	ownershipOff = "off"
+	//ownershipTXT marks owned records with a companion TXT record in the zone
+	ownershipTXT = "txt"
+	//ownershipState remembers owned records in the state file
+	ownershipState = "state"
+)
+
+// ownershipRecordName returns the name of the TXT record marking ownership of the record name, e.g. _goddns.www
+func ownershipRecordName(name string) string {
+	if name == "@" {
+		return "_goddns"
+	}
+	return "_goddns." + name
+}
+
+// markedRecordName returns the name of the record marked by the ownership TXT record name, e.g. www for _goddns.www
+func markedRecordName(name string) (string, bool) {
+	if name == "_goddns" {
+		return "@", true
+	}
+	if strings.HasPrefix(name, "_goddns.") {
+		return strings.TrimPrefix(name, "_goddns."), true
+	}
+	return "", false
+}
+
+// ownershipValue is the content of the TXT records marking records owned by this instance
+func ownershipValue() string {
+	return fmt.Sprintf("heritage=go-ddns,owner=%s", ownerID)
+}
+
+// zoneOwnership knows which records of a zone are owned by go-ddns
+type zoneOwnership struct {
+	domain string
+	//txtRecords are all TXT records of the zone, only loaded with ownershipTXT
+	txtRecords []GodaddyDNSRecord
+}
+
+// loadZoneOwnership loads the ownership markers of the zone of domain
+func loadZoneOwnership(ctx context.Context, domain string) (*zoneOwnership, error) {
+	zo := &zoneOwnership{domain: domain}
+	if ownershipMode != ownershipTXT {
+		return zo, nil
+	}
+	var err error
+	zo.txtRecords, err = getDomainRecords(ctx, domain, "TXT")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ownership TXT records for domain %s: %w", domain, err)
+	}
+	return zo, nil
+}
+
+// owns reports whether go-ddns owns the record name
+func (zo *zoneOwnership) owns(name string) bool {
+	switch ownershipMode {
+	case ownershipTXT:
+		for _, value := range recordValues(zo.txtRecords, ownershipRecordName(name)) {
+			if value == ownershipValue() {
+				return true
+			}
+		}
+		return false
+	case ownershipState:
+		return state.record(recordFQDN(name, zo.domain)).Owned
+	default:
+		return true
+	}
+}
+
+// claim marks the records in names as owned by go-ddns.
+// Records are claimed before they are written, so a failed write is retried on the next update.
+func (zo *zoneOwnership) claim(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	switch ownershipMode {
+	case ownershipTXT:
+		markers := make([]GodaddyDNSRecord, 0, len(names))
+		for _, name := range names {
+			markers = append(markers, GodaddyDNSRecord{
+				Data: ownershipValue(),
+				Name: ownershipRecordName(name),
+				TTL:  defaultTTL,
+			})
+		}
+		err := updateZoneRecords(ctx, zo.domain, "TXT", zo.txtRecords, markers, nil)
+		if err != nil {
+			return fmt.Errorf("failed to write ownership TXT records for domain %s: %w", zo.domain, err)
+		}
+	case ownershipState:
+		for _, name := range names {
+			state.record(recordFQDN(name, zo.domain)).Owned = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkPolicy returns an error if the credential in use may not write the record with the given FQDN.
+// Credentials without a policy in GD_CONFIG may write every record.
+func checkPolicy(fqdn string) error {
+	patterns, ok := fileConfig.Policies[credentialName]
+	if !ok {
+		return nil
+	}
+	for _, pattern := range patterns {
+		if matchPattern(pattern, fqdn) {
+			return nil
+		}
+	}
+	return fmt.Errorf("credential %s is not allowed to write %s", credentialName, fqdn)
+}
+
+// matchPattern reports whether fqdn matches pattern, which is either a FQDN or *.<domain> matching every name
+// below domain, but not domain itself
+func matchPattern(pattern, fqdn string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	fqdn = strings.ToLower(strings.TrimSuffix(fqdn, "."))
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(fqdn, pattern[1:])
+	}
+	return pattern == fqdn
+}
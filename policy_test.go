@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUpdateZoneRecordsPolicy(t *testing.T) {
+	defer func(config FileConfig, name string) { fileConfig, credentialName = config, name }(fileConfig, credentialName)
+	fileConfig = FileConfig{Policies: map[string][]string{"env": {"home.example.com"}}}
+	credentialName = "env"
+
+	tests := []struct {
+		name       string
+		recordType string
+		updates    []GodaddyDNSRecord
+		deleted    []string
+	}{
+		{"single", "A", []GodaddyDNSRecord{{Name: "www", Data: "192.0.2.1"}}, nil},
+		{"batch", "A", []GodaddyDNSRecord{{Name: "home", Data: "192.0.2.1"}, {Name: "www", Data: "192.0.2.1"}}, nil},
+		{"delete", "A", nil, []string{"@"}},
+		{"ownership marker", "TXT", []GodaddyDNSRecord{{Name: "_goddns.www", Data: ownershipValue()}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//a forbidden name must fail before anything is sent to godaddy
+			err := updateZoneRecords(context.Background(), "example.com", tt.recordType, nil, tt.updates, tt.deleted)
+			if err == nil || !strings.Contains(err.Error(), "is not allowed to write") {
+				t.Errorf("updateZoneRecords() error = %v, want a policy violation", err)
+			}
+		})
+	}
+}
+
+func TestMarkedRecordName(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"_goddns", "@", true},
+		{"_goddns.www", "www", true},
+		{"www", "", false},
+		{"_goddnsx", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := markedRecordName(tt.name); got != tt.want || ok != tt.ok {
+			t.Errorf("markedRecordName(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PTRConfig maintains the PTR record of the published address in a delegated reverse zone with RFC 2136 updates
+type PTRConfig struct {
+	//Server is the primary name server of the reverse zone, host[:port]
+	Server string `json:"server"`
+	//Zone is the reverse zone, e.g. 2.0.192.in-addr.arpa, 0/26.2.0.192.in-addr.arpa for RFC 2317 delegations
+	//or a nibble boundary in ip6.arpa
+	Zone string `json:"zone"`
+	//Target is the name the PTR record points to, defaults to the record itself
+	Target string `json:"target,omitempty"`
+	//TTL of the PTR record, defaults to 600
+	TTL uint32 `json:"ttl,omitempty"`
+	//TSIGName, TSIGAlgorithm and TSIGSecret (base64) sign the updates, the algorithm defaults to hmac-sha256
+	TSIGName      string `json:"tsigName,omitempty"`
+	TSIGAlgorithm string `json:"tsigAlgorithm,omitempty"`
+	TSIGSecret    string `json:"tsigSecret,omitempty"`
+
+	key *tsigKey
+}
+
+func (pc *PTRConfig) validate() error {
+	if pc.Server == "" || pc.Zone == "" {
+		return errors.New("ptr needs a server and a zone")
+	}
+	if pc.TSIGName == "" {
+		return nil
+	}
+	secret, err := base64.StdEncoding.DecodeString(pc.TSIGSecret)
+	if err != nil || len(secret) == 0 {
+		return errors.New("ptr tsigSecret must be base64")
+	}
+	algorithm := strings.TrimSuffix(strings.ToLower(pc.TSIGAlgorithm), ".")
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+	if _, ok := tsigAlgorithms[algorithm]; !ok {
+		return fmt.Errorf("unsupported TSIG algorithm %s, must be hmac-sha256 or hmac-sha512", pc.TSIGAlgorithm)
+	}
+	pc.key = &tsigKey{name: pc.TSIGName, algorithm: algorithm, secret: secret}
+	return nil
+}
+
+// updatePTRRecords points the PTR records of the domain's records to them once their forward record was written
+func updatePTRRecords(ctx context.Context, domain string, summary *runSummary) error {
+	var errs []string
+	for _, name := range recordNames {
+		fqdn := recordFQDN(name, domain)
+		rc := recordConfig(fqdn)
+		rs := state.record(fqdn)
+		if rc.PTR == nil || rs.Value == "" || rs.Value == rs.PTRValue {
+			continue
+		}
+		if rc.Lifecycle != nil && rc.Lifecycle.Action == lifecyclePark && rs.Value == rc.Lifecycle.ParkIP {
+			continue
+		}
+		if err := rc.PTR.update(ctx, fqdn, rs.Value, rs.PTRValue); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", fqdn, err))
+			summary.failed(fqdn)
+			continue
+		}
+		log.Infof("Pointed PTR record of %s to %s", rs.Value, fqdn)
+		rs.PTRValue = rs.Value
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to update PTR records: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// update replaces the PTR record of value and deletes the one of previous if it is in the same zone
+func (pc *PTRConfig) update(ctx context.Context, fqdn, value, previous string) error {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return err
+	}
+	name, err := ptrName(addr, pc.Zone)
+	if err != nil {
+		return err
+	}
+	target := pc.Target
+	if target == "" {
+		target = fqdn
+	}
+	rdata, err := appendDNSName(nil, target)
+	if err != nil {
+		return err
+	}
+	ttl := pc.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	msg := &dnsMessage{
+		ID:        newDNSID(),
+		Flags:     dnsOpcodeUpdate << 11,
+		Questions: []dnsQuestion{{Name: pc.Zone, Type: dnsTypeSOA, Class: dnsClassIN}},
+	}
+	if old, err := netip.ParseAddr(previous); err == nil {
+		if oldName, err := ptrName(old, pc.Zone); err == nil && oldName != name {
+			msg.Authority = append(msg.Authority, dnsRR{Name: oldName, Type: dnsTypePTR, Class: dnsClassANY})
+		}
+	}
+	msg.Authority = append(msg.Authority,
+		dnsRR{Name: name, Type: dnsTypePTR, Class: dnsClassANY},
+		dnsRR{Name: name, Type: dnsTypePTR, Class: dnsClassIN, TTL: ttl, Data: rdata},
+	)
+	var mac []byte
+	if pc.key != nil {
+		if mac, err = pc.key.sign(msg, time.Now()); err != nil {
+			return err
+		}
+	}
+	res, err := dnsExchange(ctx, "tcp", pc.Server, msg)
+	if err != nil {
+		return err
+	}
+	if err := res.rcodeError(); err != nil {
+		return err
+	}
+	if pc.key != nil {
+		return pc.key.verify(res, mac, time.Now())
+	}
+	return nil
+}
+
+// ptrName returns the name of the PTR record of addr in zone. For RFC 2317 zones like 0/26.2.0.192.in-addr.arpa the
+// last octet is prepended to the zone, matching the CNAMEs in the parent zone.
+func ptrName(addr netip.Addr, zone string) (string, error) {
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	var labels []string
+	if addr.Is4() {
+		b := addr.As4()
+		for i := 3; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(b[i])))
+		}
+		labels = append(labels, "in-addr", "arpa")
+	} else {
+		b := addr.As16()
+		for i := 15; i >= 0; i-- {
+			labels = append(labels, strconv.FormatUint(uint64(b[i]&0xf), 16), strconv.FormatUint(uint64(b[i]>>4), 16))
+		}
+		labels = append(labels, "ip6", "arpa")
+	}
+	name := strings.Join(labels, ".")
+	if strings.HasSuffix(name, "."+zone) {
+		return name, nil
+	}
+	//RFC 2317: the first label of the zone is the range of the delegated block inside the /24
+	if block, parent, ok := strings.Cut(zone, "."); ok && addr.Is4() && parent == strings.Join(labels[1:], ".") {
+		last := int(addr.As4()[3])
+		if first, end, ok := classlessRange(block); ok && last >= first && last <= end {
+			return labels[0] + "." + zone, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not in reverse zone %s", addr, zone)
+}
+
+// classlessRange parses the first label of an RFC 2317 zone, <start>/<bits> or <start>-<end>
+func classlessRange(block string) (int, int, bool) {
+	if start, bits, ok := strings.Cut(block, "/"); ok {
+		first, err1 := strconv.Atoi(start)
+		n, err2 := strconv.Atoi(bits)
+		if err1 != nil || err2 != nil || n < 24 || n > 32 {
+			return 0, 0, false
+		}
+		return first, first + 1<<(32-n) - 1, true
+	}
+	if start, end, ok := strings.Cut(block, "-"); ok {
+		first, err1 := strconv.Atoi(start)
+		last, err2 := strconv.Atoi(end)
+		return first, last, err1 == nil && err2 == nil
+	}
+	return 0, 0, false
+}
+
+// tsigFudge is the allowed clock skew between go-ddns and the name server
+const tsigFudge = 300
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha256": sha256.New,
+	"hmac-sha512": sha512.New,
+}
+
+// tsigKey signs messages as described in RFC 8945
+type tsigKey struct {
+	name      string
+	algorithm string
+	secret    []byte
+}
+
+// sign appends a TSIG record to msg and returns its MAC, which the response is signed with
+func (k *tsigKey) sign(msg *dnsMessage, now time.Time) ([]byte, error) {
+	packed, err := msg.pack()
+	if err != nil {
+		return nil, err
+	}
+	signed := uint64(now.Unix())
+	mac, err := k.mac(nil, packed, signed, tsigFudge)
+	if err != nil {
+		return nil, err
+	}
+	rdata, _ := appendDNSName(nil, k.algorithm)
+	rdata = appendTSIGTime(rdata, signed, tsigFudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(mac)))
+	rdata = append(rdata, mac...)
+	rdata = binary.BigEndian.AppendUint16(rdata, msg.ID)
+	rdata = binary.BigEndian.AppendUint32(rdata, 0) // error and other len
+	msg.Additional = append(msg.Additional, dnsRR{Name: k.name, Type: dnsTypeTSIG, Class: dnsClassANY, Data: rdata})
+	return mac, nil
+}
+
+// verify checks the TSIG record of the response to a request signed with requestMAC, now is compared with its time
+func (k *tsigKey) verify(res *dnsMessage, requestMAC []byte, now time.Time) error {
+	if res.tsigOffset == 0 || len(res.Additional) == 0 {
+		return errors.New("response is not signed")
+	}
+	rr := res.Additional[len(res.Additional)-1]
+	if rr.Type != dnsTypeTSIG {
+		return errors.New("TSIG record is not the last one in the response")
+	}
+	_, off, err := readDNSName(rr.Data, 0)
+	if err != nil || off+10 > len(rr.Data) {
+		return errors.New("malformed TSIG record in response")
+	}
+	signed := uint64(binary.BigEndian.Uint16(rr.Data[off:]))<<32 | uint64(binary.BigEndian.Uint32(rr.Data[off+2:]))
+	fudge := binary.BigEndian.Uint16(rr.Data[off+6:])
+	size := int(binary.BigEndian.Uint16(rr.Data[off+8:]))
+	if off+10+size+6 > len(rr.Data) {
+		return errors.New("malformed TSIG record in response")
+	}
+	got := rr.Data[off+10 : off+10+size]
+	originalID := binary.BigEndian.Uint16(rr.Data[off+10+size:])
+	if tsigError := binary.BigEndian.Uint16(rr.Data[off+12+size:]); tsigError != 0 {
+		return fmt.Errorf("server rejected the TSIG signature with error %d", tsigError)
+	}
+	//the MAC covers the response without its TSIG record and with the original ID
+	unsigned := append([]byte(nil), res.raw[:res.tsigOffset]...)
+	binary.BigEndian.PutUint16(unsigned[0:], originalID)
+	binary.BigEndian.PutUint16(unsigned[10:], uint16(len(res.Additional)-1))
+	prefix := binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC)))
+	want, err := k.mac(append(prefix, requestMAC...), unsigned, signed, fudge)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(got, want) {
+		return errors.New("TSIG signature of the response does not match")
+	}
+	if diff := now.Sub(time.Unix(int64(signed), 0)); diff > time.Duration(fudge)*time.Second || diff < -time.Duration(fudge)*time.Second {
+		return errors.New("TSIG signature of the response is outside the allowed time window")
+	}
+	return nil
+}
+
+// mac computes the MAC over prefix, the message and the TSIG variables
+func (k *tsigKey) mac(prefix, msg []byte, signed uint64, fudge uint16) ([]byte, error) {
+	h := hmac.New(tsigAlgorithms[k.algorithm], k.secret)
+	h.Write(prefix)
+	h.Write(msg)
+	vars, err := appendDNSName(nil, k.name)
+	if err != nil {
+		return nil, err
+	}
+	vars = binary.BigEndian.AppendUint16(vars, dnsClassANY)
+	vars = binary.BigEndian.AppendUint32(vars, 0)
+	vars, _ = appendDNSName(vars, k.algorithm)
+	vars = appendTSIGTime(vars, signed, fudge)
+	vars = binary.BigEndian.AppendUint32(vars, 0) // error and other len
+	h.Write(vars)
+	return h.Sum(nil), nil
+}
+
+// appendTSIGTime appends the 48 bit time signed and the fudge
+func appendTSIGTime(b []byte, signed uint64, fudge uint16) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(signed>>32))
+	b = binary.BigEndian.AppendUint32(b, uint32(signed))
+	return binary.BigEndian.AppendUint16(b, fudge)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPTRName(t *testing.T) {
+	tests := []struct {
+		addr, zone string
+		want       string
+		wantErr    bool
+	}{
+		{"192.0.2.7", "2.0.192.in-addr.arpa", "7.2.0.192.in-addr.arpa", false},
+		{"192.0.2.7", "2.0.192.IN-ADDR.ARPA.", "7.2.0.192.in-addr.arpa", false},
+		{"192.0.2.7", "0.192.in-addr.arpa", "7.2.0.192.in-addr.arpa", false},
+		{"192.0.3.7", "2.0.192.in-addr.arpa", "", true},
+		{"2001:db8::1", "8.b.d.0.1.0.0.2.ip6.arpa",
+			"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", false},
+		{"2001:db8:1:2::abcd", "2.0.0.0.1.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+			"d.c.b.a.0.0.0.0.0.0.0.0.0.0.0.0.2.0.0.0.1.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", false},
+		{"2001:db8::1", "9.b.d.0.1.0.0.2.ip6.arpa", "", true},
+		{"192.0.2.7", "8.b.d.0.1.0.0.2.ip6.arpa", "", true},
+		//RFC 2317 classless delegations
+		{"192.0.2.7", "0/26.2.0.192.in-addr.arpa", "7.0/26.2.0.192.in-addr.arpa", false},
+		{"192.0.2.63", "0/26.2.0.192.in-addr.arpa", "63.0/26.2.0.192.in-addr.arpa", false},
+		{"192.0.2.64", "0/26.2.0.192.in-addr.arpa", "", true},
+		{"192.0.2.70", "64/26.2.0.192.in-addr.arpa", "70.64/26.2.0.192.in-addr.arpa", false},
+		{"192.0.2.7", "0-63.2.0.192.in-addr.arpa", "7.0-63.2.0.192.in-addr.arpa", false},
+		{"192.0.2.64", "0-63.2.0.192.in-addr.arpa", "", true},
+		{"192.0.3.7", "0/26.2.0.192.in-addr.arpa", "", true},
+		{"192.0.2.7", "0/20.2.0.192.in-addr.arpa", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ptrName(netip.MustParseAddr(tt.addr), tt.zone)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ptrName(%s, %s) = %q, %v, want %q, wantErr %v", tt.addr, tt.zone, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// tsigVector is an RFC 8945 hmac-sha256 exchange computed independently of go-ddns: an update of
+// 7.2.0.192.in-addr.arpa signed at 1700000000 and its response signed a second later
+var tsigVector = struct {
+	key                       tsigKey
+	request, mac, response    string
+	requestTime, responseTime int64
+}{
+	key: tsigKey{name: "update-key", algorithm: "hmac-sha256", secret: []byte{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+	}},
+	request: "123428000001000000020001013201300331393207696e2d61646472046172706100000600010137013201300331393207696e2d" +
+		"61646472046172706100000c00ff0000000000000137013201300331393207696e2d61646472046172706100000c0001000002580012" +
+		"04686f6d65076578616d706c6503636f6d000a7570646174652d6b65790000fa00ff00000000003d0b686d61632d7368613235360000" +
+		"006553f100012c002075b6eec79db368bbcce286e046e405b8915009d81e322ac2ea10838825a7f9e8123400000000",
+	mac: "75b6eec79db368bbcce286e046e405b8915009d81e322ac2ea10838825a7f9e8",
+	response: "1234a8000001000000000001013201300331393207696e2d61646472046172706100000600010a7570646174652d6b65790000fa00" +
+		"ff00000000003d0b686d61632d7368613235360000006553f101012c0020c462c64f50a1fdd35650d0ad69e2a50b1c113c901bc55373" +
+		"3b657ad19a1e0c98123400000000",
+	requestTime:  1700000000,
+	responseTime: 1700000001,
+}
+
+func TestTSIGSign(t *testing.T) {
+	msg := &dnsMessage{
+		ID:        0x1234,
+		Flags:     dnsOpcodeUpdate << 11,
+		Questions: []dnsQuestion{{Name: "2.0.192.in-addr.arpa", Type: dnsTypeSOA, Class: dnsClassIN}},
+		Authority: []dnsRR{
+			{Name: "7.2.0.192.in-addr.arpa", Type: dnsTypePTR, Class: dnsClassANY},
+			{Name: "7.2.0.192.in-addr.arpa", Type: dnsTypePTR, Class: dnsClassIN, TTL: 600,
+				Data: []byte("\x04home\x07example\x03com\x00")},
+		},
+	}
+	key := tsigVector.key
+	mac, err := key.sign(msg, time.Unix(tsigVector.requestTime, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(mac); got != tsigVector.mac {
+		t.Errorf("sign() MAC = %s, want %s", got, tsigVector.mac)
+	}
+	packed, err := msg.pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(packed); got != tsigVector.request {
+		t.Errorf("signed request = %s, want %s", got, tsigVector.request)
+	}
+}
+
+func TestTSIGVerify(t *testing.T) {
+	response, _ := hex.DecodeString(tsigVector.response)
+	requestMAC, _ := hex.DecodeString(tsigVector.mac)
+	signedAt := time.Unix(tsigVector.responseTime, 0)
+	tamperedMAC := append([]byte(nil), requestMAC...)
+	tamperedMAC[0] ^= 1
+	//flips a bit in the question of the response
+	tampered := append([]byte(nil), response...)
+	tampered[14] ^= 1
+	//the response without its TSIG record
+	parsed, err := unpackDNSMessage(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := append([]byte(nil), response[:parsed.tsigOffset]...)
+	unsigned[11] = 0
+	//the TSIG record moved to the answer section, leaving the additional section empty
+	inAnswer := append([]byte(nil), response...)
+	inAnswer[7], inAnswer[11] = 1, 0
+	//an OPT record after the TSIG record
+	notLast := append(append([]byte(nil), response...), 0, 0, 41, 4, 208, 0, 0, 0, 0, 0, 0)
+	notLast[11] = 2
+
+	tests := []struct {
+		name       string
+		response   []byte
+		requestMAC []byte
+		now        time.Time
+		wantErr    bool
+	}{
+		{"valid", response, requestMAC, signedAt, false},
+		{"within fudge", response, requestMAC, signedAt.Add(tsigFudge * time.Second), false},
+		{"tampered response", tampered, requestMAC, signedAt, true},
+		{"other request", response, tamperedMAC, signedAt, true},
+		{"too late", response, requestMAC, signedAt.Add((tsigFudge + 1) * time.Second), true},
+		{"too early", response, requestMAC, signedAt.Add(-(tsigFudge + 1) * time.Second), true},
+		{"unsigned", unsigned, requestMAC, signedAt, true},
+		{"TSIG in the answer section", inAnswer, requestMAC, signedAt, true},
+		{"TSIG not the last record", notLast, requestMAC, signedAt, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := unpackDNSMessage(tt.response)
+			if err == nil {
+				key := tsigVector.key
+				err = key.verify(res, tt.requestMAC, tt.now)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
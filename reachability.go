@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const challengePath = "/.well-known/go-ddns/"
+
+var (
+	challengeMu    sync.Mutex
+	challengeToken string
+	//challengeSecret keys the challenge responses, so anything that merely echoes the requested path fails the check
+	challengeSecret = make([]byte, 32)
+
+	challengeServerOnce sync.Once
+	challengeServerErr  error
+)
+
+// challengeHandler answers requests for the current challenge token with its response
+func challengeHandler(w http.ResponseWriter, r *http.Request) {
+	challengeMu.Lock()
+	token := challengeToken
+	challengeMu.Unlock()
+	if token == "" || r.URL.Path != challengePath+token {
+		http.NotFound(w, r)
+		return
+	}
+	_, _ = io.WriteString(w, challengeResponse(token))
+}
+
+// challengeResponse is the HMAC of the token, only this instance knows the secret to compute it
+func challengeResponse(token string) string {
+	mac := hmac.New(sha256.New, challengeSecret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// startChallengeServer starts serving challenge tokens on GD_REACHABILITY_PORT, it only ever starts one server
+func startChallengeServer() error {
+	challengeServerOnce.Do(func() {
+		if _, challengeServerErr = rand.Read(challengeSecret); challengeServerErr != nil {
+			return
+		}
+		var listener net.Listener
+		listener, challengeServerErr = net.Listen("tcp", net.JoinHostPort("", reachabilityPort))
+		if challengeServerErr != nil {
+			return
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc(challengePath, challengeHandler)
+		server := &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			if err := server.Serve(listener); err != nil {
+				log.Errorf("Reachability challenge server stopped: %v", err)
+			}
+		}()
+		log.Debugf("Serving reachability challenges on port %s", reachabilityPort)
+	})
+	return challengeServerErr
+}
+
+// checkReachability confirms that the detected IP reaches us by fetching the response to a fresh challenge token,
+// which only this instance can compute, from the detected IP, either directly or through GD_REACHABILITY_HELPER.
+// It reports whether the records may be updated with the detected IP.
+func checkReachability(ctx context.Context, detected string) bool {
+	if reachabilityPort == "" {
+		return true
+	}
+	err := verifyChallenge(ctx, detected)
+	if err == nil {
+		log.Debugf("%s is reachable on port %s", detected, reachabilityPort)
+		return true
+	}
+	msg := fmt.Sprintf("%s does not reach go-ddns on port %s, not updating any records: %v", detected, reachabilityPort, err)
+	log.Error(msg)
+	notify(ctx, "unreachable", "", msg)
+	return false
+}
+
+func verifyChallenge(ctx context.Context, detected string) error {
+	if err := startChallengeServer(); err != nil {
+		return fmt.Errorf("failed to serve challenges: %v", err)
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(raw)
+	challengeMu.Lock()
+	challengeToken = token
+	challengeMu.Unlock()
+	defer func() {
+		challengeMu.Lock()
+		challengeToken = ""
+		challengeMu.Unlock()
+	}()
+
+	challengeURL := fmt.Sprintf("http://%s%s%s", net.JoinHostPort(detected, reachabilityPort), challengePath, token)
+	target := challengeURL
+	if reachabilityHelper != "" {
+		//the helper fetches the challenge from outside, so hairpin NAT doesn't get in the way
+		target = strings.ReplaceAll(reachabilityHelper, "{url}", url.QueryEscape(challengeURL))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s sent non-ok status code %d", target, res.StatusCode)
+	}
+	if !hmac.Equal(body, []byte(challengeResponse(token))) {
+		return fmt.Errorf("%s did not return the challenge response", target)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+)
+
+// FileConfig is the optional JSON configuration file in GD_CONFIG for settings that don't fit into environment variables
+type FileConfig struct {
+	//Records holds per-record settings keyed by the FQDN of the record, e.g. www.example.com or example.com for @
+	Records map[string]*RecordConfig `json:"records"`
+	//Policies restricts the records each credential may write, keyed by the name of the credential in the credential
+	//store or env for GD_API_KEY. Entries are FQDNs or *.<domain>.
+	Policies map[string][]string `json:"policies"`
+	//FreezeWindows are the periods in which no records are updated, unless a record has its own
+	FreezeWindows []*FreezeWindow `json:"freezeWindows"`
+}
+
+// RecordConfig holds the settings of a single record. Without any settings the detected IP is published as is.
+type RecordConfig struct {
+	//Type is the record type, A (default) or AAAA
+	Type string `json:"type,omitempty"`
+	//Source is where the address comes from: public (default), interface:<name> or tailscale[:<socket>]
+	Source string `json:"source,omitempty"`
+	//Static is published instead of the detected IP
+	Static string `json:"static,omitempty"`
+	//Map translates the detected IP from one prefix to another, keeping the host part, e.g. for 1:1 NAT
+	Map []IPMapping `json:"map,omitempty"`
+	//Offset is added to the detected IP after mapping, e.g. 2 to publish .3 for a gateway at .1
+	Offset int64 `json:"offset,omitempty"`
+	//OnlyIn restricts publishing to detected IPs in one of these prefixes
+	OnlyIn []string `json:"onlyIn,omitempty"`
+	//Internal is published to GD_HOSTS_FILE alongside the public value
+	Internal *InternalConfig `json:"internal,omitempty"`
+	//FreezeWindows replace the global freeze windows for this record, an empty list disables them
+	FreezeWindows []*FreezeWindow `json:"freezeWindows,omitempty"`
+	//Approval queues every change of this record until it is approved
+	Approval bool `json:"approval,omitempty"`
+	//Shared records hold the values of several instances, each one only adds and removes its own value
+	Shared bool `json:"shared,omitempty"`
+	//Lifecycle parks, deletes or lowers the TTL of the record on shutdown or when its source keeps failing
+	Lifecycle *LifecycleConfig `json:"lifecycle,omitempty"`
+	//PTR maintains the reverse record of the published address via RFC 2136
+	PTR *PTRConfig `json:"ptr,omitempty"`
+
+	mappings []ipMapping
+	onlyIn   []netip.Prefix
+}
+
+// IPMapping maps addresses in the prefix From to the same host in the prefix To, both prefixes must be the same size
+type IPMapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type ipMapping struct {
+	from, to netip.Prefix
+}
+
+var fileConfig FileConfig
+
+// loadConfigFile reads and validates the configuration file at path
+func loadConfigFile(path string) error {
+	fileConfig = FileConfig{}
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	for fqdn, rc := range fileConfig.Records {
+		if err := rc.validate(); err != nil {
+			return fmt.Errorf("invalid settings for record %s: %v", fqdn, err)
+		}
+	}
+	for _, fw := range fileConfig.FreezeWindows {
+		if err := fw.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rc *RecordConfig) validate() error {
+	if rc.Type != "" && rc.Type != "A" && rc.Type != "AAAA" {
+		return fmt.Errorf("unsupported record type %s", rc.Type)
+	}
+	if _, _, err := parseSource(rc.Source); err != nil {
+		return err
+	}
+	if rc.Static != "" {
+		addr, err := netip.ParseAddr(rc.Static)
+		if err != nil {
+			return fmt.Errorf("invalid static address: %v", err)
+		}
+		if !matchesType(addr, rc.recordType()) {
+			return fmt.Errorf("static address %s can't be published in a %s record", addr, rc.recordType())
+		}
+	}
+	for _, m := range rc.Map {
+		from, err := netip.ParsePrefix(m.From)
+		if err != nil {
+			return fmt.Errorf("invalid mapping: %v", err)
+		}
+		to, err := netip.ParsePrefix(m.To)
+		if err != nil {
+			return fmt.Errorf("invalid mapping: %v", err)
+		}
+		if !from.Addr().Is4() || !to.Addr().Is4() || from.Bits() != to.Bits() {
+			return fmt.Errorf("mapping from %s to %s must map between IPv4 prefixes of the same size", from, to)
+		}
+		rc.mappings = append(rc.mappings, ipMapping{from: from.Masked(), to: to.Masked()})
+	}
+	for _, p := range rc.OnlyIn {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return fmt.Errorf("invalid onlyIn prefix: %v", err)
+		}
+		rc.onlyIn = append(rc.onlyIn, prefix.Masked())
+	}
+	for _, fw := range rc.FreezeWindows {
+		if err := fw.validate(); err != nil {
+			return err
+		}
+	}
+	if rc.Lifecycle != nil {
+		if err := rc.Lifecycle.validate(); err != nil {
+			return err
+		}
+	}
+	if rc.PTR != nil {
+		if err := rc.PTR.validate(); err != nil {
+			return err
+		}
+	}
+	if rc.Internal != nil {
+		if hostsFile == "" {
+			return errors.New("internal needs GD_HOSTS_FILE to be set")
+		}
+		return rc.Internal.validate()
+	}
+	return nil
+}
+
+// recordConfig returns the settings of the record with the given FQDN
+func recordConfig(fqdn string) *RecordConfig {
+	if rc, ok := fileConfig.Records[fqdn]; ok {
+		return rc
+	}
+	return &RecordConfig{}
+}
+
+// recordType returns the type of the record
+func (rc *RecordConfig) recordType() string {
+	if rc.Type == "" {
+		return "A"
+	}
+	return rc.Type
+}
+
+// publishedValue returns the value to publish for the detected IP and whether the record should be published at all
+func (rc *RecordConfig) publishedValue(detected string) (string, bool, error) {
+	addr, err := netip.ParseAddr(detected)
+	if err != nil {
+		return "", false, err
+	}
+	if len(rc.onlyIn) > 0 {
+		in := false
+		for _, prefix := range rc.onlyIn {
+			in = in || prefix.Contains(addr)
+		}
+		if !in {
+			return "", false, nil
+		}
+	}
+	if rc.Static != "" {
+		return rc.Static, true, nil
+	}
+	for _, m := range rc.mappings {
+		if m.from.Contains(addr) {
+			host := ipv4ToUint(addr) &^ ipv4ToUint(m.from.Addr())
+			addr = uintToIPv4(ipv4ToUint(m.to.Addr()) | host)
+			break
+		}
+	}
+	if rc.Offset != 0 {
+		if !addr.Is4() {
+			return "", false, fmt.Errorf("offset can only be applied to IPv4 addresses, got %s", addr)
+		}
+		shifted := int64(ipv4ToUint(addr)) + rc.Offset
+		if shifted < 0 || shifted > 0xffffffff {
+			return "", false, fmt.Errorf("offset %d is out of range for %s", rc.Offset, addr)
+		}
+		addr = uintToIPv4(uint32(shifted))
+	}
+	if !matchesType(addr, rc.recordType()) {
+		return "", false, fmt.Errorf("%s can't be published in a %s record", addr, rc.recordType())
+	}
+	return addr.String(), true, nil
+}
+
+func ipv4ToUint(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func uintToIPv4(i uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], i)
+	return netip.AddrFrom4(b)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecordConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rc      RecordConfig
+		wantErr bool
+	}{
+		{"empty", RecordConfig{}, false},
+		{"static v4 in A", RecordConfig{Static: "192.0.2.1"}, false},
+		{"static v6 in AAAA", RecordConfig{Type: "AAAA", Static: "2001:db8::1"}, false},
+		{"static v6 in A", RecordConfig{Static: "2001:db8::1"}, true},
+		{"static v4 in AAAA", RecordConfig{Type: "AAAA", Static: "192.0.2.1"}, true},
+		{"invalid static", RecordConfig{Static: "example.com"}, true},
+		{"mapping of different sizes", RecordConfig{Map: []IPMapping{{From: "192.0.2.0/24", To: "198.51.100.0/25"}}}, true},
+		{"mapping of v6", RecordConfig{Map: []IPMapping{{From: "2001:db8::/64", To: "2001:db8:1::/64"}}}, true},
+		{"unsupported type", RecordConfig{Type: "CNAME"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := tt.rc
+			if err := rc.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublishedValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		rc          RecordConfig
+		detected    string
+		want        string
+		wantPublish bool
+		wantErr     bool
+	}{
+		{"as is", RecordConfig{}, "203.0.113.7", "203.0.113.7", true, false},
+		{"static", RecordConfig{Static: "192.0.2.1"}, "203.0.113.7", "192.0.2.1", true, false},
+		{"mapped", RecordConfig{Map: []IPMapping{{From: "203.0.113.0/24", To: "198.51.100.0/24"}}}, "203.0.113.7", "198.51.100.7", true, false},
+		{"not mapped", RecordConfig{Map: []IPMapping{{From: "192.0.2.0/24", To: "198.51.100.0/24"}}}, "203.0.113.7", "203.0.113.7", true, false},
+		{"mapped and offset", RecordConfig{Map: []IPMapping{{From: "203.0.113.0/24", To: "198.51.100.0/24"}}, Offset: 2}, "203.0.113.1", "198.51.100.3", true, false},
+		{"offset across octets", RecordConfig{Offset: 1}, "192.0.2.255", "192.0.3.0", true, false},
+		{"negative offset", RecordConfig{Offset: -2}, "192.0.2.3", "192.0.2.1", true, false},
+		{"offset overflow", RecordConfig{Offset: 1}, "255.255.255.255", "", false, true},
+		{"offset underflow", RecordConfig{Offset: -1}, "0.0.0.0", "", false, true},
+		{"offset on v6", RecordConfig{Type: "AAAA", Offset: 1}, "2001:db8::1", "", false, true},
+		{"v6 in A", RecordConfig{}, "2001:db8::1", "", false, true},
+		{"v4 in AAAA", RecordConfig{Type: "AAAA"}, "192.0.2.1", "", false, true},
+		{"inside onlyIn", RecordConfig{OnlyIn: []string{"203.0.113.0/24"}}, "203.0.113.7", "203.0.113.7", true, false},
+		{"outside onlyIn", RecordConfig{OnlyIn: []string{"192.0.2.0/24"}}, "203.0.113.7", "", false, false},
+		{"invalid detected", RecordConfig{}, "not an ip", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := tt.rc
+			if err := rc.validate(); err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			got, publish, err := rc.publishedValue(tt.detected)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("publishedValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || publish != tt.wantPublish {
+				t.Errorf("publishedValue() = %q, %v, want %q, %v", got, publish, tt.want, tt.wantPublish)
+			}
+		})
+	}
+}
+
+func TestRecordValueStatic(t *testing.T) {
+	//a shutting down resolver fails every source
+	sources := newSourceResolver(context.Background(), true)
+	rc := RecordConfig{Source: "interface:doesnotexist", Static: "198.51.100.10"}
+	if err := rc.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	value, publish, err := recordValue(sources, &rc, "www.example.com")
+	if err != nil || !publish || value != "198.51.100.10" {
+		t.Errorf("recordValue() = %q, %v, %v, want the static value", value, publish, err)
+	}
+	rc = RecordConfig{Source: "interface:doesnotexist", Static: "198.51.100.10", OnlyIn: []string{"192.0.2.0/24"}}
+	if err := rc.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	if _, publish, err := recordValue(sources, &rc, "www.example.com"); err == nil || publish {
+		t.Errorf("recordValue() with onlyIn = %v, %v, want the source error", publish, err)
+	}
+}
+
+func TestLifecycleTTL(t *testing.T) {
+	tests := []struct {
+		ttl     uint64
+		wantErr bool
+	}{
+		{0, true},
+		{300, true},
+		{599, true},
+		{600, false},
+		{3600, false},
+	}
+	for _, tt := range tests {
+		rc := RecordConfig{Lifecycle: &LifecycleConfig{Action: lifecycleLowerTTL, TTL: tt.ttl, OnShutdown: true}}
+		if err := rc.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate() with lowerTTL ttl %d error = %v, wantErr %v", tt.ttl, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// dnsResolver sends queries over plain DNS, DNS-over-TLS (RFC 7858) or DNS-over-HTTPS (RFC 8484), so they can't be
+// hijacked by the ISP
+type dnsResolver struct {
+	spec string
+	//scheme is udp, tls or https
+	scheme string
+	//addr is host:port for udp and tls
+	addr string
+	url  string
+}
+
+// bootstrapDialer resolves the hostnames of DoT and DoH resolvers with the system resolver, even after
+// net.DefaultResolver was replaced with GD_DNS_RESOLVER
+var bootstrapDialer = &net.Dialer{Resolver: &net.Resolver{}}
+
+// dohClient sends DNS-over-HTTPS queries
+var dohClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: &http.Transport{DialContext: bootstrapDialer.DialContext, ForceAttemptHTTP2: true},
+}
+
+// parseResolver parses host[:port] or udp://host[:port] for plain DNS, tls://host[:port] for DNS-over-TLS and
+// https://host/path for DNS-over-HTTPS
+func parseResolver(spec string) (*dnsResolver, error) {
+	r := &dnsResolver{spec: spec, scheme: "udp"}
+	port := "53"
+	host := spec
+	switch {
+	case strings.HasPrefix(spec, "https://"):
+		u, err := url.Parse(spec)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid DNS-over-HTTPS resolver %s", spec)
+		}
+		r.scheme, r.url = "https", spec
+		return r, nil
+	case strings.HasPrefix(spec, "tls://"):
+		r.scheme, port = "tls", "853"
+		host = strings.TrimPrefix(spec, "tls://")
+	case strings.HasPrefix(spec, "udp://"):
+		host = strings.TrimPrefix(spec, "udp://")
+	case strings.Contains(spec, "://"):
+		return nil, fmt.Errorf("unsupported resolver %s, must be host[:port], udp://, tls:// or https://", spec)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("resolver %s has no host", spec)
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		r.addr = host
+	} else if addr, err := netip.ParseAddr(host); err == nil {
+		r.addr = net.JoinHostPort(addr.String(), port)
+	} else {
+		r.addr = net.JoinHostPort(host, port)
+	}
+	return r, nil
+}
+
+func (r *dnsResolver) String() string {
+	return r.spec
+}
+
+// trusted reports whether responses can't be changed on the way from the resolver, so its AD flag can be relied on
+// (RFC 6840 section 5.7): DNS over TLS and HTTPS, or plain DNS to a resolver on this host
+func (r *dnsResolver) trusted() bool {
+	if r.scheme != "udp" {
+		return true
+	}
+	host, _, _ := net.SplitHostPort(r.addr)
+	addr, err := netip.ParseAddr(host)
+	return host == "localhost" || (err == nil && addr.IsLoopback())
+}
+
+// exchange sends msg to the resolver and returns the response
+func (r *dnsResolver) exchange(ctx context.Context, msg *dnsMessage) (*dnsMessage, error) {
+	if r.scheme == "udp" {
+		return dnsExchange(ctx, "udp", r.addr, msg)
+	}
+	query, err := msg.pack()
+	if err != nil {
+		return nil, err
+	}
+	var response []byte
+	if r.scheme == "https" {
+		response, err = r.post(ctx, query)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		var conn net.Conn
+		if conn, err = r.dialTLS(ctx); err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		response, err = exchangeStream(conn, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := unpackDNSMessage(response)
+	if err != nil {
+		return nil, err
+	}
+	if res.ID != msg.ID {
+		return nil, fmt.Errorf("DNS response from %s has mismatched ID", r)
+	}
+	return res, nil
+}
+
+func (r *dnsResolver) dialTLS(ctx context.Context) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(r.addr)
+	dialer := &tls.Dialer{NetDialer: bootstrapDialer, Config: &tls.Config{ServerName: host}}
+	return dialer.DialContext(ctx, "tcp", r.addr)
+}
+
+// post sends a DNS-over-HTTPS query
+func (r *dnsResolver) post(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", r.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	res, err := dohClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s sent non-ok status code %d", r.url, res.StatusCode)
+	}
+	return body, nil
+}
+
+// netResolver returns a resolver for the net package that sends all lookups through this resolver
+func (r *dnsResolver) netResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			switch r.scheme {
+			case "tls":
+				//go's resolver uses the TCP framing for connections that aren't a net.PacketConn
+				return r.dialTLS(ctx)
+			case "https":
+				return &dohConn{ctx: ctx, resolver: r}, nil
+			}
+			return bootstrapDialer.DialContext(ctx, network, r.addr)
+		},
+	}
+}
+
+// dohConn lets go's resolver send DNS-over-HTTPS queries, every length-prefixed query written to it is posted to the
+// resolver and the response can be read from it with the same framing
+type dohConn struct {
+	ctx      context.Context
+	resolver *dnsResolver
+	response bytes.Buffer
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	if len(b) < 2 || int(binary.BigEndian.Uint16(b)) != len(b)-2 {
+		return 0, errors.New("DNS-over-HTTPS queries must be written at once")
+	}
+	res, err := c.resolver.post(c.ctx, b[2:])
+	if err != nil {
+		return 0, err
+	}
+	c.response.Write(binary.BigEndian.AppendUint16(nil, uint16(len(res))))
+	c.response.Write(res)
+	return len(b), nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error)         { return c.response.Read(b) }
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *dohConn) SetDeadline(_ time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(_ time.Time) error { return nil }
+
+// dnsIPSources are shortcuts for DNS-based IP sources that only work with the resolver of their operator. Only
+// cloudflare answers over TLS, the others are plain UDP and can be forged on the way.
+var dnsIPSources = map[string]string{
+	"dns:cloudflare": "dns:whoami.cloudflare/TXT/CH@tls://1.1.1.1",
+	"dns:opendns":    "dns:myip.opendns.com/A@208.67.222.222",
+	"dns:google":     "dns:o-o.myaddr.l.google.com/TXT@216.239.32.10",
+}
+
+// getIPAddressFromDNS gets the public IP address of this device from a DNS-based source,
+// dns:<name>[/<type>[/<class>]][@<resolver>], e.g. dns:whoami.cloudflare/TXT/CH@tls://1.1.1.1
+func getIPAddressFromDNS(ctx context.Context, source string) (string, error) {
+	if alias, ok := dnsIPSources[source]; ok {
+		source = alias
+	}
+	spec, resolverSpec, _ := strings.Cut(strings.TrimPrefix(source, "dns:"), "@")
+	parts := strings.Split(spec, "/")
+	q := dnsQuestion{Name: parts[0], Type: dnsTypeA, Class: dnsClassIN}
+	if len(parts) > 1 {
+		switch strings.ToUpper(parts[1]) {
+		case "A":
+		case "AAAA":
+			q.Type = dnsTypeAAAA
+		case "TXT":
+			q.Type = dnsTypeTXT
+		default:
+			return "", fmt.Errorf("unsupported type %s in %s, must be A, AAAA or TXT", parts[1], source)
+		}
+	}
+	if len(parts) > 2 && strings.ToUpper(parts[2]) == "CH" {
+		q.Class = dnsClassCH
+	}
+	resolver := lookupResolver
+	if resolverSpec != "" {
+		var err error
+		if resolver, err = parseResolver(resolverSpec); err != nil {
+			return "", err
+		}
+	}
+	if resolver == nil {
+		return "", fmt.Errorf("%s needs a resolver, append @<resolver> or set GD_DNS_RESOLVER", source)
+	}
+	res, err := dnsQuery(ctx, resolver, q, false)
+	if err != nil {
+		return "", err
+	}
+	if err := res.rcodeError(); err != nil {
+		return "", err
+	}
+	values := res.addresses()
+	values = append(values, res.texts()...)
+	for _, v := range values {
+		if ip := net.ParseIP(v); ip != nil {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s did not respond with an IP address", source)
+}
@@ -0,0 +1,35 @@
+package main
+
+import "sort"
+
+// sharedValues returns the values a shared record should have: the current values with previous, the value this
+// instance wrote before, replaced by value. An empty value withdraws this instance from the record.
+func sharedValues(values []string, previous, value string) []string {
+	var res []string
+	for _, v := range values {
+		if v != previous && v != value {
+			res = append(res, v)
+		}
+	}
+	if value != "" {
+		res = append(res, value)
+	}
+	return res
+}
+
+// sameValues reports whether a and b contain the same values, regardless of their order
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
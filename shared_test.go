@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSharedValues(t *testing.T) {
+	tests := []struct {
+		name            string
+		values          []string
+		previous, value string
+		want            []string
+	}{
+		{"empty record", nil, "", "192.0.2.1", []string{"192.0.2.1"}},
+		{"join", []string{"198.51.100.1"}, "", "192.0.2.1", []string{"198.51.100.1", "192.0.2.1"}},
+		{"replace ours", []string{"198.51.100.1", "192.0.2.1"}, "192.0.2.1", "192.0.2.2", []string{"198.51.100.1", "192.0.2.2"}},
+		{"unchanged", []string{"192.0.2.1", "198.51.100.1"}, "192.0.2.1", "192.0.2.1", []string{"198.51.100.1", "192.0.2.1"}},
+		{"withdraw", []string{"198.51.100.1", "192.0.2.1"}, "192.0.2.1", "", []string{"198.51.100.1"}},
+		{"withdraw last", []string{"192.0.2.1"}, "192.0.2.1", "", nil},
+		{"previous already gone", []string{"198.51.100.1"}, "192.0.2.1", "192.0.2.2", []string{"198.51.100.1", "192.0.2.2"}},
+	}
+	for _, tt := range tests {
+		if got := sharedValues(tt.values, tt.previous, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: sharedValues(%v, %q, %q) = %v, want %v", tt.name, tt.values, tt.previous, tt.value, got, tt.want)
+		}
+	}
+}
+
+// setupSharedZone configures example.com with the shared record lb and the plain records www and api, restoring the
+// previous configuration after the test
+func setupSharedZone(t *testing.T) {
+	t.Helper()
+	d, r, fc, s := domains, recordNames, fileConfig, state
+	t.Cleanup(func() { domains, recordNames, fileConfig, state = d, r, fc, s })
+	domains = []string{"example.com"}
+	recordNames = []string{"lb", "www", "api"}
+	//the loopback interface stands in for the detected IP, 127.0.0.1
+	fileConfig = FileConfig{Records: map[string]*RecordConfig{
+		"lb.example.com":  {Shared: true, Source: "interface:lo"},
+		"www.example.com": {Source: "interface:lo"},
+		"api.example.com": {Source: "interface:lo"},
+	}}
+	state = newState()
+}
+
+func TestResyncKeepsSharedValue(t *testing.T) {
+	setupSharedZone(t)
+	fake := installFakeGodaddy(t, map[string][]GodaddyDNSRecord{"A": {
+		{Name: "lb", Data: "198.51.100.1", TTL: 600},
+		{Name: "lb", Data: "203.0.113.2", TTL: 600},
+		{Name: "www", Data: "127.0.0.1", TTL: 600},
+		{Name: "api", Data: "127.0.0.1", TTL: 600},
+	}})
+	state.record("lb.example.com").Value = "203.0.113.2"
+	state.record("www.example.com").Value = "127.0.0.1"
+
+	state.forget()
+	if got := state.record("lb.example.com").Value; got != "203.0.113.2" {
+		t.Fatalf("forget() dropped the value of the shared record, got %q", got)
+	}
+	if _, ok := state.Records["www.example.com"]; ok {
+		t.Error("forget() kept a record that is neither owned nor shared")
+	}
+
+	err := checkAndUpdate(context.Background(), "example.com", newSourceResolver(context.Background(), false), updateForce, newRunSummary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recordValues(fake.zone["A"], "lb"); !sameValues(got, []string{"198.51.100.1", "127.0.0.1"}) {
+		t.Errorf("shared record after resync = %v, want the other instance's value and ours only", got)
+	}
+}
+
+func TestUpdateZoneRecordsSharedZone(t *testing.T) {
+	setupSharedZone(t)
+	fake := installFakeGodaddy(t, map[string][]GodaddyDNSRecord{"A": {
+		{Name: "lb", Data: "198.51.100.1", TTL: 600},
+		{Name: "www", Data: "192.0.2.1", TTL: 600},
+		{Name: "api", Data: "192.0.2.1", TTL: 600},
+	}})
+	snapshot := append([]GodaddyDNSRecord(nil), fake.zone["A"]...)
+	//another instance joins the shared record after our snapshot was taken
+	fake.zone["A"] = append(fake.zone["A"], GodaddyDNSRecord{Name: "lb", Data: "198.51.100.2", TTL: 600})
+
+	updates := []GodaddyDNSRecord{{Name: "www", Data: "127.0.0.1", TTL: 600}}
+	if err := updateZoneRecords(context.Background(), "example.com", "A", snapshot, updates, []string{"api"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DELETE /v1/domains/example.com/records/A/api", "PUT /v1/domains/example.com/records/A/www"}
+	if !reflect.DeepEqual(fake.requests, want) {
+		t.Errorf("requests = %v, want %v", fake.requests, want)
+	}
+	if got := recordValues(fake.zone["A"], "lb"); !sameValues(got, []string{"198.51.100.1", "198.51.100.2"}) {
+		t.Errorf("lb = %v, the concurrent update of the other instance was reverted", got)
+	}
+	if got := recordValues(fake.zone["A"], "www"); !sameValues(got, []string{"127.0.0.1"}) {
+		t.Errorf("www = %v, want 127.0.0.1", got)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// record sources, set per record through the source setting in GD_CONFIG
+const (
+	//sourcePublic is the public IP detected through GD_IP_SOURCES, this is the default
+	sourcePublic = "public"
+	//sourceInterface is the address of a local network interface, e.g. interface:wg0
+	sourceInterface = "interface"
+	//sourceTailscale is the tailscale address of this node, optionally followed by the path of the tailscaled socket
+	sourceTailscale = "tailscale"
+)
+
+const defaultTailscaleSocket = "/var/run/tailscale/tailscaled.sock"
+
+// parseSource splits a source setting like interface:wg0 into its kind and argument
+func parseSource(source string) (kind, arg string, err error) {
+	if source == "" {
+		return sourcePublic, "", nil
+	}
+	kind, arg, _ = strings.Cut(source, ":")
+	switch kind {
+	case sourcePublic:
+	case sourceInterface:
+		if arg == "" {
+			return "", "", errors.New("interface source needs an interface name, e.g. interface:wg0")
+		}
+	case sourceTailscale:
+		if arg == "" {
+			arg = defaultTailscaleSocket
+		}
+	default:
+		return "", "", fmt.Errorf("unknown source %q", source)
+	}
+	return kind, arg, nil
+}
+
+// errShuttingDown is returned by every source while applying the shutdown lifecycle
+var errShuttingDown = errors.New("shutting down")
+
+// sourceResolver resolves the address of every source at most once per update
+type sourceResolver struct {
+	ctx context.Context
+	//shutdown makes every source fail without trying it, so no record gets a value from us
+	shutdown bool
+	cache    map[string]sourceResult
+	failed   bool
+}
+
+type sourceResult struct {
+	addr string
+	err  error
+}
+
+func newSourceResolver(ctx context.Context, shutdown bool) *sourceResolver {
+	return &sourceResolver{ctx: ctx, shutdown: shutdown, cache: make(map[string]sourceResult)}
+}
+
+// address returns the address of source for records of the given type
+func (r *sourceResolver) address(source, recordType string) (string, error) {
+	if r.shutdown {
+		return "", errShuttingDown
+	}
+	key := describeSource(source) + "/" + recordType
+	if res, ok := r.cache[key]; ok {
+		return res.addr, res.err
+	}
+	addr, err := r.resolve(source, recordType)
+	if err != nil {
+		log.Errorf("Failed to get address from source %s: %v", describeSource(source), err)
+		r.failed = true
+	}
+	r.cache[key] = sourceResult{addr: addr, err: err}
+	return addr, err
+}
+
+func (r *sourceResolver) resolve(source, recordType string) (string, error) {
+	kind, arg, err := parseSource(source)
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case sourceInterface:
+		return interfaceAddress(arg, recordType)
+	case sourceTailscale:
+		return tailscaleAddress(r.ctx, arg, recordType)
+	}
+	if recordType != "A" {
+		return "", errors.New("the public source only detects IPv4 addresses")
+	}
+	ip, err := getPublicIPAddress(r.ctx)
+	if err != nil {
+		return "", err
+	}
+	if !checkNAT(r.ctx, ip) || !checkReachability(r.ctx, ip) {
+		return "", fmt.Errorf("%s failed the NAT or reachability check", ip)
+	}
+	return ip, nil
+}
+
+func describeSource(source string) string {
+	if source == "" {
+		return sourcePublic
+	}
+	return source
+}
+
+// matchesType reports whether addr can be published in a record of the given type
+func matchesType(addr netip.Addr, recordType string) bool {
+	if recordType == "AAAA" {
+		return addr.Is6() && !addr.Is4In6() && !addr.IsLinkLocalUnicast()
+	}
+	return addr.Is4() || addr.Is4In6()
+}
+
+// interfaceAddress returns the first address of the interface that fits the record type, e.g. of a wireguard interface
+func interfaceAddress(name, recordType string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(ipNet.IP); ok && matchesType(addr, recordType) {
+			return addr.Unmap().String(), nil
+		}
+	}
+	return "", fmt.Errorf("interface %s has no address for %s records", name, recordType)
+}
+
+// tailscaleAddress asks the tailscaled local API on socket for the tailscale addresses of this node
+func tailscaleAddress(ctx context.Context, socket, recordType string) (string, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+		Timeout: httpClient.Timeout,
+	}
+	//the host is ignored, tailscaled only checks it to reject requests from browsers
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://local-tailscaled.sock/localapi/v0/status", nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("tailscaled sent non-ok status code %d", res.StatusCode)
+	}
+	var status struct {
+		Self struct {
+			TailscaleIPs []string `json:"TailscaleIPs"`
+		} `json:"Self"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return "", fmt.Errorf("failed to parse tailscale status: %v", err)
+	}
+	for _, ip := range status.Self.TailscaleIPs {
+		if addr, err := netip.ParseAddr(ip); err == nil && matchesType(addr, recordType) {
+			return addr.String(), nil
+		}
+	}
+	return "", fmt.Errorf("tailscale reports no address for %s records", recordType)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// serveTailscaleStatus serves status as the local API of tailscaled on a temporary unix socket
+func serveTailscaleStatus(t *testing.T, status string) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "tailscaled.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/localapi/v0/status", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, status)
+	})
+	server := &http.Server{Handler: mux}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return socket
+}
+
+func TestTailscaleAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		recordType string
+		want       string
+		wantErr    bool
+	}{
+		{"A", `{"Self":{"TailscaleIPs":["100.101.102.103","fd7a:115c:a1e0::1"]}}`, "A", "100.101.102.103", false},
+		{"AAAA", `{"Self":{"TailscaleIPs":["100.101.102.103","fd7a:115c:a1e0::1"]}}`, "AAAA", "fd7a:115c:a1e0::1", false},
+		{"IPv6 listed first", `{"Self":{"TailscaleIPs":["fd7a:115c:a1e0::1","100.101.102.103"]}}`, "A", "100.101.102.103", false},
+		{"no IPv6", `{"Self":{"TailscaleIPs":["100.101.102.103"]}}`, "AAAA", "", true},
+		{"not logged in", `{"Self":{"TailscaleIPs":null}}`, "A", "", true},
+		{"invalid json", `{`, "A", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket := serveTailscaleStatus(t, tt.status)
+			got, err := tailscaleAddress(context.Background(), socket, tt.recordType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tailscaleAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("tailscaleAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTailscaleAddressNoSocket(t *testing.T) {
+	if _, err := tailscaleAddress(context.Background(), filepath.Join(t.TempDir(), "missing.sock"), "A"); err == nil {
+		t.Error("tailscaleAddress() succeeded without tailscaled")
+	}
+}
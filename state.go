@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State is what go-ddns remembers about the records it manages between updates.
+// It is persisted to GD_STATE_FILE if set and only kept in memory otherwise.
+type State struct {
+	Records map[string]*RecordState `json:"records"`
+	//Pending holds the changes waiting for approval, keyed by their ID and guarded by stateMu
+	Pending map[string]*PendingChange `json:"pending"`
+	//Health is read by the healthcheck command and the control server, also guarded by stateMu
+	Health Health `json:"health"`
+}
+
+// RecordState is the state of a single record, keyed by its FQDN in State.Records
+type RecordState struct {
+	//Value is the value go-ddns last wrote to the record
+	Value     string    `json:"value"`
+	WrittenAt time.Time `json:"writtenAt"`
+	//Drifted is the foreign value we last alerted about, so every change is only reported once
+	Drifted string `json:"drifted,omitempty"`
+	//AdoptedFor is the detected IP at the time a foreign value was adopted
+	AdoptedFor string `json:"adoptedFor,omitempty"`
+	//Owned is set once go-ddns created or took over the record, used with GD_OWNERSHIP=state
+	Owned bool `json:"owned,omitempty"`
+	//FailingSince is when the source of the record started failing, zero while it works
+	FailingSince time.Time `json:"failingSince"`
+	//ChangedAt is when go-ddns last changed the value, StablePeriod how long it has to stay unchanged afterwards
+	//before the TTL is raised again
+	ChangedAt    time.Time     `json:"changedAt"`
+	StablePeriod time.Duration `json:"stablePeriod"`
+	//PTRValue is the address whose PTR record points to this record
+	PTRValue string `json:"ptrValue,omitempty"`
+	//VerifyError is the last verification problem of the record, so it is only notified once
+	VerifyError string `json:"verifyError,omitempty"`
+}
+
+var state = newState()
+
+// stateMu guards the parts of the state the control server reads and changes while an update runs: state.Pending and
+// state.Health. saveState holds it while marshalling, so the file never contains a half-changed queue. Records are
+// only touched by the update loop and need no lock.
+var stateMu sync.Mutex
+
+func newState() *State {
+	return &State{
+		Records: make(map[string]*RecordState),
+		Pending: make(map[string]*PendingChange),
+	}
+}
+
+// record returns the state of the record with the given FQDN, creating it if necessary
+func (s *State) record(fqdn string) *RecordState {
+	rs, ok := s.Records[fqdn]
+	if !ok {
+		rs = &RecordState{}
+		s.Records[fqdn] = rs
+	}
+	return rs
+}
+
+// forget drops everything we know about the records except which of them we own and the value we wrote to shared
+// records, which is the only way to tell our entry apart from the ones of other instances
+func (s *State) forget() {
+	for fqdn, rs := range s.Records {
+		kept := &RecordState{Owned: rs.Owned}
+		if recordConfig(fqdn).Shared {
+			kept.Value = rs.Value
+		}
+		if kept.Owned || kept.Value != "" {
+			s.Records[fqdn] = kept
+		} else {
+			delete(s.Records, fqdn)
+		}
+	}
+}
+
+// loadState reads the state from GD_STATE_FILE, a missing file results in an empty state
+func loadState() error {
+	state = newState()
+	if stateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return err
+	}
+	if state.Records == nil {
+		state.Records = make(map[string]*RecordState)
+	}
+	if state.Pending == nil {
+		state.Pending = make(map[string]*PendingChange)
+	}
+	return nil
+}
+
+// saveState writes the state to GD_STATE_FILE, replacing the old file atomically
+func saveState() error {
+	if stateFile == "" {
+		return nil
+	}
+	stateMu.Lock()
+	data, err := json.MarshalIndent(state, "", "  ")
+	stateMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(stateFile, data, 0600)
+}
+
+// writeFileAtomic replaces the file at path with data and the permissions perm, so readers never see a partially
+// written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// outcomes of a record in one update
+const (
+	outcomeUnchanged = "unchanged"
+	outcomeUpdated   = "updated"
+	outcomeFailed    = "failed"
+	//outcomeSkipped is a record that may need an update, but was left alone, e.g. because it isn't ours, it drifted,
+	//it is frozen or its change waits for approval
+	outcomeSkipped = "skipped"
+)
+
+// runSummary collects the outcome of every record checked in one update
+type runSummary struct {
+	start    time.Time
+	outcomes map[string]string
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{start: time.Now(), outcomes: make(map[string]string)}
+}
+
+// check adds the record as unchanged until it is updated or fails
+func (s *runSummary) check(fqdn string) {
+	s.outcomes[fqdn] = outcomeUnchanged
+}
+
+func (s *runSummary) updated(fqdn string) {
+	if s.outcomes[fqdn] != outcomeFailed {
+		s.outcomes[fqdn] = outcomeUpdated
+	}
+}
+
+func (s *runSummary) skipped(fqdn string) {
+	if s.outcomes[fqdn] != outcomeFailed {
+		s.outcomes[fqdn] = outcomeSkipped
+	}
+}
+
+func (s *runSummary) failed(fqdn string) {
+	s.outcomes[fqdn] = outcomeFailed
+}
+
+// records returns the sorted records with the given outcome
+func (s *runSummary) records(outcome string) []string {
+	var res []string
+	for fqdn, o := range s.outcomes {
+		if o == outcome {
+			res = append(res, fqdn)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// finish logs the summary as one event and writes it to GD_SUMMARY_FILE if set
+func (s *runSummary) finish() {
+	duration := time.Since(s.start)
+	updated, skipped, failed := s.records(outcomeUpdated), s.records(outcomeSkipped), s.records(outcomeFailed)
+	fields := log.Fields{
+		"checked":   len(s.outcomes),
+		"unchanged": len(s.records(outcomeUnchanged)),
+		"updated":   len(updated),
+		"skipped":   len(skipped),
+		"failed":    len(failed),
+		"duration":  duration.Round(time.Millisecond).String(),
+	}
+	if len(updated) > 0 {
+		fields["updatedRecords"] = strings.Join(updated, ",")
+	}
+	if len(skipped) > 0 {
+		fields["skippedRecords"] = strings.Join(skipped, ",")
+	}
+	if len(failed) > 0 {
+		fields["failedRecords"] = strings.Join(failed, ",")
+	}
+	log.WithFields(fields).Info("Update finished")
+	if summaryFile == "" {
+		return
+	}
+	if err := writeFileAtomic(summaryFile, []byte(s.metrics(duration)), 0644); err != nil {
+		log.Errorf("Failed to write summary to %s: %v", summaryFile, err)
+	}
+}
+
+// metrics returns the summary in the Prometheus text format, e.g. for the textfile collector of node_exporter
+func (s *runSummary) metrics(duration time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "# HELP goddns_last_run_timestamp_seconds Time the last update finished.")
+	fmt.Fprintln(&b, "# TYPE goddns_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(&b, "goddns_last_run_timestamp_seconds %d\n", time.Now().Unix())
+	fmt.Fprintln(&b, "# HELP goddns_last_run_duration_seconds Duration of the last update.")
+	fmt.Fprintln(&b, "# TYPE goddns_last_run_duration_seconds gauge")
+	fmt.Fprintf(&b, "goddns_last_run_duration_seconds %.3f\n", duration.Seconds())
+	fmt.Fprintln(&b, "# HELP goddns_records Records checked in the last update by outcome.")
+	fmt.Fprintln(&b, "# TYPE goddns_records gauge")
+	outcomes := []string{outcomeUnchanged, outcomeUpdated, outcomeSkipped, outcomeFailed}
+	for _, outcome := range outcomes {
+		fmt.Fprintf(&b, "goddns_records{outcome=%q} %d\n", outcome, len(s.records(outcome)))
+	}
+	fmt.Fprintln(&b, "# HELP goddns_record_outcome Outcome of each record in the last update, 1 for the outcome it had.")
+	fmt.Fprintln(&b, "# TYPE goddns_record_outcome gauge")
+	fqdns := make([]string, 0, len(s.outcomes))
+	for fqdn := range s.outcomes {
+		fqdns = append(fqdns, fqdn)
+	}
+	sort.Strings(fqdns)
+	for _, fqdn := range fqdns {
+		for _, outcome := range outcomes {
+			value := 0
+			if s.outcomes[fqdn] == outcome {
+				value = 1
+			}
+			fmt.Fprintf(&b, "goddns_record_outcome{record=%q,outcome=%q} %d\n", fqdn, outcome, value)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSkippedOutcome(t *testing.T) {
+	defer func(d, r []string, fc FileConfig, s *State, om, dp string, takeover bool) {
+		domains, recordNames, fileConfig, state, ownershipMode, driftPolicy, allowTakeover = d, r, fc, s, om, dp, takeover
+	}(domains, recordNames, fileConfig, state, ownershipMode, driftPolicy, allowTakeover)
+	domains = []string{"example.com"}
+	recordNames = []string{"www"}
+
+	tests := []struct {
+		name  string
+		setup func()
+	}{
+		{"not owned", func() {
+			ownershipMode = ownershipState
+		}},
+		{"drift alert", func() {
+			driftPolicy = driftPolicyAlert
+			state.record("www.example.com").Value = "192.0.2.1"
+		}},
+		{"frozen", func() {
+			fileConfig.FreezeWindows = []*FreezeWindow{{Start: "00:00", End: "23:59"}, {Start: "23:59", End: "00:00"}}
+			for _, fw := range fileConfig.FreezeWindows {
+				_ = fw.validate()
+			}
+		}},
+		{"waiting for approval", func() {
+			fileConfig.Records["www.example.com"].Approval = true
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//the record has a foreign value, the loopback interface stands in for the detected IP
+			fileConfig = FileConfig{Records: map[string]*RecordConfig{"www.example.com": {Source: "interface:lo"}}}
+			state = newState()
+			ownershipMode, driftPolicy, allowTakeover = ownershipOff, driftPolicyOverwrite, false
+			tt.setup()
+			fake := installFakeGodaddy(t, map[string][]GodaddyDNSRecord{"A": {{Name: "www", Data: "198.51.100.1", TTL: 600}}})
+
+			summary := newRunSummary()
+			summary.check("www.example.com")
+			if err := checkAndUpdate(context.Background(), "example.com", newSourceResolver(context.Background(), false), updateNormal, summary); err != nil {
+				t.Fatal(err)
+			}
+			if got := summary.outcomes["www.example.com"]; got != outcomeSkipped {
+				t.Errorf("outcome = %s, want %s", got, outcomeSkipped)
+			}
+			if len(fake.requests) != 1 {
+				t.Errorf("requests = %v, want only reading the zone", fake.requests)
+			}
+			if !strings.Contains(summary.metrics(0), `goddns_records{outcome="skipped"} 1`) {
+				t.Errorf("metrics don't count the skipped record:\n%s", summary.metrics(0))
+			}
+		})
+	}
+}
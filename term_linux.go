@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// promptSecret asks for a line like prompt, but doesn't echo the answer when stdin is a terminal
+func promptSecret(in *bufio.Reader, question string) string {
+	fd := int(os.Stdin.Fd())
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		//not a terminal, e.g. piped in
+		return prompt(in, question)
+	}
+	noEcho := *termios
+	noEcho.Lflag &^= unix.ECHO
+	noEcho.Lflag |= unix.ICANON | unix.ISIG
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &noEcho); err != nil {
+		return prompt(in, question)
+	}
+	defer func() {
+		_ = unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+		fmt.Println()
+	}()
+	return prompt(in, question)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "bufio"
+
+// promptSecret asks for a line like prompt, hiding the answer is only supported on linux
+func promptSecret(in *bufio.Reader, question string) string {
+	return prompt(in, question)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// maxStablePeriod caps how long a flapping record keeps the low TTL after its last change
+const maxStablePeriod = 24 * time.Hour
+
+// adaptiveTTLEnabled reports whether GD_TTL_MIN and GD_TTL_MAX differ, otherwise every record gets GD_TTL_MAX
+func adaptiveTTLEnabled() bool {
+	return ttlMin < ttlMax
+}
+
+// adaptiveTTL returns the TTL to write with value: GD_TTL_MIN if the record changes now or changed recently,
+// GD_TTL_MAX once it has been stable for long enough
+func adaptiveTTL(rs *RecordState, value string) uint64 {
+	if !adaptiveTTLEnabled() {
+		return ttlMax
+	}
+	if rs.Value != "" && rs.Value != value {
+		return ttlMin
+	}
+	if !rs.ChangedAt.IsZero() && time.Since(rs.ChangedAt) < rs.StablePeriod {
+		return ttlMin
+	}
+	return ttlMax
+}
+
+// trackChange remembers when the record changed to value. A change before the record became stable again counts as
+// flapping and doubles the period the record has to be stable for before its TTL is raised.
+func trackChange(rs *RecordState, fqdn, value string) {
+	if !adaptiveTTLEnabled() || rs.Value == "" || rs.Value == value {
+		return
+	}
+	if !rs.ChangedAt.IsZero() && time.Since(rs.ChangedAt) < rs.StablePeriod {
+		rs.StablePeriod *= 2
+		if rs.StablePeriod > maxStablePeriod {
+			rs.StablePeriod = maxStablePeriod
+		}
+		log.Warnf("%s changed again before it was stable, keeping the low TTL for %v", fqdn, rs.StablePeriod)
+	} else {
+		rs.StablePeriod = ttlStableAfter
+	}
+	rs.ChangedAt = time.Now()
+}
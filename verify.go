@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errDNSSECBogus is returned for records the resolver only answers with DNSSEC validation disabled
+var errDNSSECBogus = errors.New("DNSSEC validation failed")
+
+// errDNSSECUnvalidated is returned for signed records the resolver did not mark as validated
+var errDNSSECUnvalidated = errors.New("DNSSEC signed answer was not validated")
+
+// verifyGrace is how long resolvers may keep answering with the old value after a write, on top of the TTL
+const verifyGrace = 5 * time.Minute
+
+// verifyRecords looks up every record go-ddns published in the domain through GD_VERIFY_RESOLVER, which is reached
+// over TLS, HTTPS or loopback so its AD flag can be trusted. It reports records that still don't resolve to the
+// published value once caches should have expired and, for signed zones, records the resolver considers bogus or
+// didn't validate. Records of unsigned zones are only compared by value, nothing proves their authenticity.
+func verifyRecords(ctx context.Context, domain string, summary *runSummary) error {
+	var errs []string
+	for _, name := range recordNames {
+		fqdn := recordFQDN(name, domain)
+		rs := state.record(fqdn)
+		if rs.Value == "" {
+			continue
+		}
+		err := verifyRecord(ctx, fqdn, recordConfig(fqdn).recordType(), rs)
+		if err == nil {
+			if rs.VerifyError != "" {
+				log.Infof("%s verifies again", fqdn)
+				rs.VerifyError = ""
+			}
+			continue
+		}
+		errs = append(errs, err.Error())
+		summary.failed(fqdn)
+		//every problem is only notified once, not with every run
+		if err.Error() != rs.VerifyError {
+			rs.VerifyError = err.Error()
+			notify(ctx, "verification", domain, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("verification failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func verifyRecord(ctx context.Context, fqdn, recordType string, rs *RecordState) error {
+	q := dnsQuestion{Name: fqdn, Type: dnsTypeA, Class: dnsClassIN}
+	if recordType == "AAAA" {
+		q.Type = dnsTypeAAAA
+	}
+	res, err := dnsQuery(ctx, verifyResolver, q, false)
+	if err != nil {
+		return fmt.Errorf("failed to look up %s at %s: %v", fqdn, verifyResolver, err)
+	}
+	if res.rcode() == dnsRcodeServFail {
+		//a validating resolver answers SERVFAIL for bogus records, but still resolves them with checking disabled
+		if cd, err := dnsQuery(ctx, verifyResolver, q, true); err == nil && cd.rcode() == dnsRcodeSuccess {
+			return fmt.Errorf("%s: %w at %s, it only resolves with checking disabled", fqdn, errDNSSECBogus, verifyResolver)
+		}
+	}
+	if err := res.rcodeError(); err != nil {
+		return fmt.Errorf("failed to look up %s at %s: %v", fqdn, verifyResolver, err)
+	}
+	if res.signed() && res.Flags&dnsFlagAD == 0 {
+		return fmt.Errorf("%s: %w by %s, it has to be a validating resolver", fqdn, errDNSSECUnvalidated, verifyResolver)
+	}
+	values := res.addresses()
+	for _, v := range values {
+		if v == rs.Value {
+			return nil
+		}
+	}
+	if time.Since(rs.WrittenAt) < time.Duration(ttlMax)*time.Second+verifyGrace {
+		log.Debugf("%s does not resolve to %s yet", fqdn, rs.Value)
+		return nil
+	}
+	return fmt.Errorf("%s resolves to %v at %s instead of %s", fqdn, values, verifyResolver, rs.Value)
+}
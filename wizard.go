@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// GodaddyDomain is a domain of the account as listed by godaddy
+type GodaddyDomain struct {
+	Domain string `json:"domain"`
+	Status string `json:"status"`
+}
+
+// listDomains returns the active domains of the account
+func listDomains(ctx context.Context) ([]GodaddyDomain, error) {
+	var domains []GodaddyDomain
+	err := withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", GodaddyApiBase+"?statuses=ACTIVE&limit=1000", nil)
+		if err != nil {
+			return err
+		}
+		body, err := doGodaddyRequest(req)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(body, &domains)
+	})
+	return domains, err
+}
+
+// runInit asks for the provider, credentials, domains and records, checks them against godaddy and writes an env
+// file and optionally a systemd unit and a compose file. It returns the exit code for the init command.
+func runInit() int {
+	in := bufio.NewReader(os.Stdin)
+	fmt.Println("This sets up go-ddns and writes its configuration. Press enter to accept the [default].")
+	if provider := promptDefault(in, "Provider", "godaddy"); provider != "godaddy" {
+		fmt.Fprintf(os.Stderr, "Unsupported provider %s, only godaddy is supported\n", provider)
+		return 1
+	}
+	apiKey = prompt(in, "GoDaddy API Key (from https://developer.godaddy.com/keys): ")
+	apiSecret = promptSecret(in, "GoDaddy API Secret: ")
+	if apiKey == "" || apiSecret == "" {
+		fmt.Fprintln(os.Stderr, "API Key and Secret must not be empty")
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	zones, err := listDomains(ctx)
+	if errorKind(err) == ErrorKindAuth {
+		fmt.Fprintf(os.Stderr, "GoDaddy rejected the credentials, check that they are production and not OTE keys: %v\n", err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list the domains of the account: %v\n", err)
+		return 1
+	}
+	if len(zones) == 0 {
+		fmt.Fprintln(os.Stderr, "The account has no active domains")
+		return 1
+	}
+	active := make(map[string]bool)
+	var all []string
+	fmt.Println("Active domains of the account:")
+	for _, z := range zones {
+		fmt.Printf("  %s\n", z.Domain)
+		active[z.Domain] = true
+		all = append(all, z.Domain)
+	}
+
+	for {
+		domains = splitList(promptDefault(in, "Domains to update, comma-separated", strings.Join(all, ",")))
+		err = nil
+		for _, d := range domains {
+			if !active[d] {
+				err = fmt.Errorf("%s is not an active domain of the account", d)
+			}
+		}
+		if err == nil && len(domains) > 0 {
+			break
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	for recordNames = nil; len(recordNames) == 0; {
+		recordNames = splitList(promptDefault(in, "Record names, comma-separated, @ for the domain itself", "@"))
+	}
+
+	fmt.Println("Current A records, go-ddns will point them to this host's public IP:")
+	for _, d := range domains {
+		records, err := getDomainRecords(ctx, d, "A")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read the A records of %s: %v\n", d, err)
+			return 1
+		}
+		for _, name := range recordNames {
+			current := "not set, will be created"
+			if values := recordValues(records, name); len(values) > 0 {
+				current = strings.Join(values, ", ")
+			}
+			fmt.Printf("  %-30s %s\n", recordFQDN(name, d), current)
+		}
+	}
+
+	interval := promptDefault(in, "Update interval", "10m")
+	if _, err := time.ParseDuration(interval); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid interval: %v\n", err)
+		return 1
+	}
+	envFile, err := filepath.Abs(promptDefault(in, "Write the configuration to", "go-ddns.env"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	credentials := fmt.Sprintf("GD_API_KEY=%s\nGD_API_SECRET=%s\n", apiKey, apiSecret)
+	var credentialsFile string
+	if promptYesNo(in, "Keep the API secret in the encrypted credential store instead of the env file?", true) {
+		if credentials, credentialsFile = storeInitCredential(in); credentials == "" {
+			return 1
+		}
+	}
+	env := fmt.Sprintf("%sGD_DOMAINS=%s\nGD_RECORDS=%s\nGD_INTERVAL=%s\n",
+		credentials, strings.Join(domains, ","), strings.Join(recordNames, ","), interval)
+	if !writeInitFile(in, envFile, env, 0600) {
+		return 1
+	}
+
+	dir := filepath.Dir(envFile)
+	if promptYesNo(in, "Write a systemd unit?", false) {
+		executable, err := os.Executable()
+		if err != nil {
+			executable = "/usr/local/bin/go-ddns"
+		}
+		//the credential store is only readable by its owner, a dynamic user can't open it
+		user := "DynamicUser=yes\n"
+		if credentialsFile != "" {
+			user = ""
+		}
+		unit := fmt.Sprintf(`[Unit]
+Description=go-ddns GoDaddy DynDNS updater
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+EnvironmentFile=%s
+Environment=GD_STATE_FILE=/var/lib/go-ddns/state.json
+StateDirectory=go-ddns
+ExecStart=%s
+ExecReload=/bin/kill -HUP $MAINPID
+%sRestart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`, envFile, executable, user)
+		if !writeInitFile(in, filepath.Join(dir, "go-ddns.service"), unit, 0644) {
+			return 1
+		}
+		fmt.Println("Copy it to /etc/systemd/system and run `systemctl enable --now go-ddns`")
+	}
+	if promptYesNo(in, "Write a docker compose file?", false) {
+		volumes := "      - go-ddns:/var/lib/go-ddns\n"
+		if credentialsFile != "" {
+			volumes += fmt.Sprintf("      - %s:%s:ro\n", credentialsFile, credentialsFile)
+		}
+		compose := fmt.Sprintf(`services:
+  go-ddns:
+    image: ghcr.io/niklasstich/goddns:latest
+    restart: unless-stopped
+    env_file: %s
+    volumes:
+%s
+volumes:
+  go-ddns:
+`, filepath.Base(envFile), volumes)
+		if !writeInitFile(in, filepath.Join(dir, "go-ddns.compose.yml"), compose, 0644) {
+			return 1
+		}
+		if credentialsFile != "" {
+			fmt.Println("Containers have no machine id, the store needs a passphrase in GD_CREDENTIALS_PASSPHRASE_FILE there")
+		}
+		fmt.Println("Start it with `docker compose -f go-ddns.compose.yml up -d`")
+	}
+	fmt.Printf("Done, check the setup with `go-ddns doctor` after loading %s\n", envFile)
+	return 0
+}
+
+// storeInitCredential saves the credentials in the credential store and returns the env lines selecting them and the
+// path of the store, or an empty string if saving failed
+func storeInitCredential(in *bufio.Reader) (string, string) {
+	path := os.Getenv("GD_CREDENTIALS_FILE")
+	if path == "" {
+		path = defaultCredentialsFile()
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", ""
+	}
+	creds, err := loadCredentials(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open credential store %s: %v\n", path, err)
+		return "", ""
+	}
+	name := promptDefault(in, "Name of the stored credential", "godaddy")
+	if _, ok := creds[name]; ok && !promptYesNo(in, fmt.Sprintf("%s is already stored, replace it?", name), false) {
+		fmt.Fprintf(os.Stderr, "Not replacing credential %s\n", name)
+		return "", ""
+	}
+	creds[name] = Credential{Provider: "godaddy", Key: apiKey, Secret: apiSecret}
+	if err := saveCredentials(path, creds); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save credential store %s: %v\n", path, err)
+		return "", ""
+	}
+	fmt.Printf("Saved credential %s in %s\n", name, path)
+	if _, source, _ := storeSecret(); source == "passphrase" {
+		fmt.Println("The passphrase is not written to the env file, the updater needs the same GD_CREDENTIALS_PASSPHRASE")
+	}
+	//the updater may run with another home directory, so the store is always given explicitly
+	return fmt.Sprintf("GD_CREDENTIAL=%s\nGD_CREDENTIALS_FILE=%s\n", name, path), path
+}
+
+// writeInitFile writes a file created by init, asking before replacing an existing one
+func writeInitFile(in *bufio.Reader, path, content string, perm os.FileMode) bool {
+	if _, err := os.Stat(path); err == nil && !promptYesNo(in, fmt.Sprintf("%s exists, replace it?", path), false) {
+		fmt.Fprintf(os.Stderr, "Not replacing %s\n", path)
+		return false
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", path, err)
+		return false
+	}
+	fmt.Printf("Wrote %s\n", path)
+	return true
+}
+
+// promptDefault asks for a value, returning def if the answer is empty
+func promptDefault(in *bufio.Reader, question, def string) string {
+	if answer := prompt(in, fmt.Sprintf("%s [%s]: ", question, def)); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// promptYesNo asks a yes/no question, returning def if the answer is empty
+func promptYesNo(in *bufio.Reader, question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := strings.ToLower(prompt(in, fmt.Sprintf("%s [%s]: ", question, hint)))
+	if answer == "" {
+		return def
+	}
+	return strings.HasPrefix(answer, "y")
+}